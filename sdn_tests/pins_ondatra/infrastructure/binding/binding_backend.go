@@ -3,6 +3,8 @@ package bindingbackend
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	gpb "github.com/openconfig/gnmi/proto/gnmi"
@@ -19,9 +21,12 @@ type ReservedTestbed struct {
 
 // Device contains data of reserved switch.
 type Device struct {
-	Name    string
-	ID      string
-	PortMap map[string]*binding.Port
+	Name            string
+	ID              string
+	PortMap         map[string]*binding.Port
+	Vendor          opb.Device_Vendor
+	HardwareModel   string
+	SoftwareVersion string
 }
 
 // GRPCService represents supported grpc service.
@@ -34,13 +39,19 @@ const (
 	GNOI GRPCService = "gnoi"
 	// GNSI represents gnsi grpc service.
 	GNSI GRPCService = "gnsi"
+	// GRIBI represents gribi grpc service.
+	GRIBI GRPCService = "gribi"
 	// P4RT represents p4rt grpc service.
 	P4RT GRPCService = "p4rt"
+	// OTG represents the open traffic generator grpc service of an ATE.
+	OTG GRPCService = "otg"
 )
 
 // GRPCServices contains addresses for services using grpc protocol.
 type GRPCServices struct {
 	Addr map[GRPCService]string
+	// Proxy contains the chain of proxies used to reach a service, if any.
+	Proxy map[GRPCService][]string
 }
 
 // HTTPService contains addresses for services using HTTP protocol.
@@ -52,12 +63,55 @@ type HTTPService struct {
 type DUTDevice struct {
 	*Device
 	GRPC GRPCServices
+	// NoSSH is set for devices that cannot be reached over SSH, e.g. fakes.
+	NoSSH bool `json:",omitempty"`
+	// NoHealthz is set for devices without a gNOI Healthz service.
+	NoHealthz bool `json:",omitempty"`
 }
 
 // ATEDevice contains device and service addresses for ATE device.
 type ATEDevice struct {
 	*Device
 	HTTP HTTPService
+	GRPC GRPCServices
+}
+
+// LinkEnd is one end of a link, identified by testbed IDs.
+type LinkEnd struct {
+	Device string // testbed device ID, e.g. "DUT"
+	Port   string // testbed port ID, e.g. "port1"
+}
+
+// Link is a cable between two reserved ports.
+type Link struct {
+	A, B LinkEnd
+}
+
+// TestbedLinks returns the links requested by the testbed, e.g. for devices
+// cabled exactly as the testbed.
+func TestbedLinks(tb *opb.Testbed) ([]*Link, error) {
+	var links []*Link
+	for _, l := range tb.GetLinks() {
+		a, err := parseLinkEnd(l.GetA())
+		if err != nil {
+			return nil, err
+		}
+		b, err := parseLinkEnd(l.GetB())
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, &Link{A: a, B: b})
+	}
+	return links, nil
+}
+
+// parseLinkEnd parses a testbed link end of the form "<device>:<port>".
+func parseLinkEnd(s string) (LinkEnd, error) {
+	device, port, ok := strings.Cut(s, ":")
+	if !ok || device == "" || port == "" {
+		return LinkEnd{}, fmt.Errorf("invalid testbed link end %q, want <device>:<port>", s)
+	}
+	return LinkEnd{Device: device, Port: port}, nil
 }
 
 // ReservedTopology represents the reserved DUT and ATE devices.
@@ -65,12 +119,18 @@ type ReservedTopology struct {
 	ID   string
 	DUTs []*DUTDevice
 	ATEs []*ATEDevice
+	// Links contains the cables between the reserved ports.
+	Links []*Link
 }
 
 // Backend exposes functions to interact with reservations and reserved devices.
 type Backend interface {
 	// ReserveTopology returns topology of reserved DUT and ATE devices.
-	ReserveTopology(ctx context.Context, tb *opb.Testbed, runtime, waittime time.Duration) (*ReservedTopology, error)
+	// partial maps testbed IDs ("dut" or "dut:port") to the device or port
+	// names they must be reserved as; it may be empty.
+	ReserveTopology(ctx context.Context, tb *opb.Testbed, runtime, waittime time.Duration, partial map[string]string) (*ReservedTopology, error)
+	// FetchTopology returns the topology of an existing reservation.
+	FetchTopology(ctx context.Context, id string) (*ReservedTopology, error)
 	// Release releases the reserved devices, called during teardown.
 	Release(ctx context.Context) error
 	// DialGRPC connects to grpc service and returns the opened grpc client for use.
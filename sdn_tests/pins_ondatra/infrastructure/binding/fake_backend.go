@@ -0,0 +1,412 @@
+// Package fakebackend implements a hermetic backend that serves in-process
+// gNMI, gNOI and P4RT fakes on loopback instead of reserving real switches,
+// and OTG fakes instead of traffic generators. Every fake device also has a
+// telnet console stand-in that prints reboot messages.
+//
+// Use it by setting the backend before running the tests:
+//
+//	func TestMain(m *testing.M) {
+//		pinsbind.SetBackend(fakebackend.New())
+//		ondatra.RunTests(m, pinsbind.New)
+//	}
+package fakebackend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/ondatra/binding"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	opb "github.com/openconfig/ondatra/proto"
+	"github.com/openconfig/ygot/ygot"
+	"github.com/openconfig/ygot/ytypes"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/pinsbackend"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	ospb "github.com/openconfig/gnoi/os"
+	syspb "github.com/openconfig/gnoi/system"
+	p4pb "github.com/p4lang/p4runtime/go/p4/v1"
+)
+
+// Backend reserves fake devices that run in the test process.
+type Backend struct {
+	mu         sync.Mutex
+	rebootTime time.Duration
+	resvCount  int
+	topology   *bindingbackend.ReservedTopology
+	devices    map[string]*Device
+	ates       map[string]*ATE
+}
+
+// Option configures the fake backend.
+type Option func(b *Backend)
+
+// WithRebootTime sets how long a fake device stays unreachable after a gNOI
+// Reboot request.
+func WithRebootTime(d time.Duration) Option {
+	return func(b *Backend) {
+		b.rebootTime = d
+	}
+}
+
+// New creates a fake backend.
+func New(opts ...Option) *Backend {
+	b := &Backend{
+		rebootTime: time.Second,
+		devices:    map[string]*Device{},
+		ates:       map[string]*ATE{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Device returns the fake device reserved for the given testbed DUT ID.
+func (b *Backend) Device(id string) (*Device, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d, ok := b.devices[id]
+	if !ok {
+		return nil, fmt.Errorf("no fake device reserved for %q", id)
+	}
+	return d, nil
+}
+
+// ATE returns the fake ATE reserved for the given testbed ATE ID.
+func (b *Backend) ATE(id string) (*ATE, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	a, ok := b.ates[id]
+	if !ok {
+		return nil, fmt.Errorf("no fake ATE reserved for %q", id)
+	}
+	return a, nil
+}
+
+// ReserveTopology starts a fake device for every DUT and a fake traffic
+// generator for every ATE of the testbed.
+func (b *Backend) ReserveTopology(ctx context.Context, tb *opb.Testbed, runtime, waitTime time.Duration, partial map[string]string) (*bindingbackend.ReservedTopology, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.topology != nil {
+		return nil, fmt.Errorf("fake topology %s is already reserved", b.topology.ID)
+	}
+
+	b.resvCount++
+	r := &bindingbackend.ReservedTopology{ID: fmt.Sprintf("fake-reservation-%d", b.resvCount)}
+	for _, dut := range tb.GetDuts() {
+		name := "fake-" + strings.ToLower(dut.GetId())
+		if n, ok := partial[dut.GetId()]; ok {
+			name = n
+		}
+
+		ports := map[string]*binding.Port{}
+		var portNames []string
+		for i, p := range dut.GetPorts() {
+			portName := fmt.Sprintf("Ethernet1/%d/1", i+1)
+			if n, ok := partial[dut.GetId()+":"+p.GetId()]; ok {
+				portName = n
+			}
+			ports[p.GetId()] = &binding.Port{Name: portName}
+			portNames = append(portNames, portName)
+		}
+
+		d, err := startDevice(name, portNames, b.rebootTime)
+		if err != nil {
+			b.stopDevices()
+			return nil, err
+		}
+		b.devices[dut.GetId()] = d
+		log.Infof("Started fake device %s for %s on %s", name, dut.GetId(), d.Addr)
+
+		r.DUTs = append(r.DUTs, &bindingbackend.DUTDevice{
+			Device: &bindingbackend.Device{
+				ID:      dut.GetId(),
+				Name:    name,
+				PortMap: ports,
+			},
+			GRPC: bindingbackend.GRPCServices{
+				Addr: map[bindingbackend.GRPCService]string{
+					bindingbackend.GNMI:  d.Addr,
+					bindingbackend.GNOI:  d.Addr,
+					bindingbackend.GNSI:  d.Addr,
+					bindingbackend.GRIBI: d.Addr,
+					bindingbackend.P4RT:  d.Addr,
+				},
+			},
+			NoSSH:     true,
+			NoHealthz: true,
+		})
+	}
+
+	for _, ate := range tb.GetAtes() {
+		name := "fake-" + strings.ToLower(ate.GetId())
+		if n, ok := partial[ate.GetId()]; ok {
+			name = n
+		}
+
+		ports := map[string]*binding.Port{}
+		for i, p := range ate.GetPorts() {
+			portName := fmt.Sprintf("%d/1", i+1)
+			if n, ok := partial[ate.GetId()+":"+p.GetId()]; ok {
+				portName = n
+			}
+			ports[p.GetId()] = &binding.Port{Name: portName}
+		}
+
+		a, err := startATE(name)
+		if err != nil {
+			b.stopDevices()
+			return nil, err
+		}
+		b.ates[ate.GetId()] = a
+		log.Infof("Started fake ATE %s for %s on %s", name, ate.GetId(), a.Addr)
+		r.ATEs = append(r.ATEs, &bindingbackend.ATEDevice{
+			Device: &bindingbackend.Device{
+				ID:      ate.GetId(),
+				Name:    name,
+				PortMap: ports,
+			},
+			GRPC: bindingbackend.GRPCServices{
+				Addr: map[bindingbackend.GRPCService]string{
+					bindingbackend.OTG: a.Addr,
+				},
+			},
+		})
+	}
+
+	// Fake devices are cabled exactly as the testbed.
+	links, err := bindingbackend.TestbedLinks(tb)
+	if err != nil {
+		b.stopDevices()
+		return nil, err
+	}
+	r.Links = links
+
+	b.topology = r
+	return r, nil
+}
+
+// FetchTopology returns the topology reserved by this backend. Fake
+// reservations live in the test process and cannot be shared.
+func (b *Backend) FetchTopology(ctx context.Context, id string) (*bindingbackend.ReservedTopology, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.topology == nil || b.topology.ID != id {
+		return nil, fmt.Errorf("fake reservation %s does not exist in this process", id)
+	}
+	return b.topology, nil
+}
+
+// Release stops all fake devices.
+func (b *Backend) Release(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopDevices()
+	b.topology = nil
+	return nil
+}
+
+func (b *Backend) stopDevices() {
+	for id, d := range b.devices {
+		d.stop()
+		delete(b.devices, id)
+	}
+	for id, a := range b.ates {
+		a.stop()
+		delete(b.ates, id)
+	}
+}
+
+// DialGRPC connects to the fake device without transport security.
+func (b *Backend) DialGRPC(ctx context.Context, addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.DialContext(ctx, addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("DialContext(%s, %v) : %v", addr, opts, err)
+	}
+	return conn, nil
+}
+
+// DialConsole connects to the console stand-in of the fake device.
+func (b *Backend) DialConsole(ctx context.Context, dut *binding.AbstractDUT) (binding.ConsoleClient, error) {
+	b.mu.Lock()
+	var addr string
+	for _, d := range b.devices {
+		if d.Name == dut.Name() {
+			addr = d.ConsoleAddr
+		}
+	}
+	b.mu.Unlock()
+	if addr == "" {
+		return nil, fmt.Errorf("no fake device named %s", dut.Name())
+	}
+	return pinsbackend.DialTelnet(ctx, addr)
+}
+
+// GNMIClient wraps the grpc connection under gnmi client.
+func (b *Backend) GNMIClient(ctx context.Context, dut *binding.AbstractDUT, conn *grpc.ClientConn) (gpb.GNMIClient, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("conn is nil")
+	}
+	return gpb.NewGNMIClient(conn), nil
+}
+
+// Close stops all fake devices.
+func (b *Backend) Close() error {
+	return b.Release(context.Background())
+}
+
+// Device is a fake switch serving gNMI, gNOI and P4RT on a loopback address.
+type Device struct {
+	Name        string
+	Addr        string
+	ConsoleAddr string
+
+	rebootTime time.Duration
+	server     *grpc.Server
+	console    *consoleServer
+
+	mu        sync.Mutex
+	schema    *ytypes.Schema
+	subs      map[chan struct{}]bool
+	p4Config  *p4pb.ForwardingPipelineConfig
+	rebooting bool
+	reboot    *syspb.RebootStatusResponse
+	// rebootTimer fires when a requested reboot starts.
+	rebootTimer *time.Timer
+	osVersion   string
+	// osNext is the OS version activated for the next reboot.
+	osNext string
+	// osImages are the SHA256 of the installed images by version.
+	osImages     map[string]string
+	osInstalling bool
+}
+
+func startDevice(name string, ports []string, rebootTime time.Duration) (*Device, error) {
+	schema, err := oc.Schema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenConfig schema: %v", err)
+	}
+	d := &Device{
+		Name:       name,
+		rebootTime: rebootTime,
+		schema:     schema,
+		subs:       map[chan struct{}]bool{},
+		reboot:     &syspb.RebootStatusResponse{},
+		osVersion:  fakeOSVersion,
+		osImages:   map[string]string{fakeOSVersion: ""},
+	}
+	d.seed(ports)
+
+	if d.console, err = startConsole(); err != nil {
+		return nil, fmt.Errorf("failed to start console of fake device %s: %v", name, err)
+	}
+	d.ConsoleAddr = d.console.addr()
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		d.console.stop()
+		return nil, fmt.Errorf("failed to listen for fake device %s: %v", name, err)
+	}
+	d.Addr = lis.Addr().String()
+	d.server = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(d.unaryInterceptor),
+		grpc.ChainStreamInterceptor(d.streamInterceptor))
+	gpb.RegisterGNMIServer(d.server, &gnmiServer{dev: d})
+	syspb.RegisterSystemServer(d.server, &systemServer{dev: d})
+	ospb.RegisterOSServer(d.server, &osServer{dev: d})
+	p4pb.RegisterP4RuntimeServer(d.server, &p4rtServer{dev: d})
+	go d.server.Serve(lis)
+	return d, nil
+}
+
+func (d *Device) stop() {
+	d.mu.Lock()
+	if d.rebootTimer != nil {
+		d.rebootTimer.Stop()
+	}
+	d.mu.Unlock()
+	d.server.Stop()
+	d.console.stop()
+}
+
+// seed populates the datastore with the state of a freshly booted switch.
+func (d *Device) seed(ports []string) {
+	root := d.root()
+	root.GetOrCreateSystem().Hostname = ygot.String(d.Name)
+	now := uint64(time.Now().UnixNano())
+	root.GetOrCreateSystem().BootTime = ygot.Uint64(now)
+	for i, port := range ports {
+		intf := root.GetOrCreateInterface(port)
+		intf.Type = oc.IETFInterfaces_InterfaceType_ethernetCsmacd
+		intf.Enabled = ygot.Bool(true)
+		intf.AdminStatus = oc.Interface_AdminStatus_UP
+		intf.OperStatus = oc.Interface_OperStatus_UP
+		intf.LastChange = ygot.Uint64(now)
+		intf.Id = ygot.Uint32(uint32(i + 1))
+		intf.GetOrCreateEthernet().PortSpeed = oc.IfEthernet_ETHERNET_SPEED_SPEED_100GB
+	}
+}
+
+// root returns the OpenConfig datastore of the device. Callers must hold mu
+// unless the device is not serving yet.
+func (d *Device) root() *oc.Root {
+	return d.schema.Root.(*oc.Root)
+}
+
+// Update modifies the datastore of the device and notifies the subscribers
+// about the change. It allows tests to emulate state changes on the switch.
+func (d *Device) Update(f func(root *oc.Root)) {
+	d.mu.Lock()
+	f(d.root())
+	d.mu.Unlock()
+	d.notify()
+}
+
+// notify signals all streaming subscriptions that the datastore changed.
+func (d *Device) notify() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for ch := range d.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// unavailable returns an error while the device is rebooting.
+func (d *Device) unavailable() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.rebooting {
+		return status.Errorf(codes.Unavailable, "%s is rebooting", d.Name)
+	}
+	return nil
+}
+
+func (d *Device) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := d.unavailable(); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (d *Device) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := d.unavailable(); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,204 @@
+package fakebackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	opb "github.com/openconfig/ondatra/proto"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	syspb "github.com/openconfig/gnoi/system"
+)
+
+const testTimeout = 10 * time.Second
+
+func testbed() *opb.Testbed {
+	return &opb.Testbed{
+		Duts: []*opb.Device{{
+			Id:    "DUT",
+			Ports: []*opb.Port{{Id: "port1"}, {Id: "port2"}},
+		}},
+	}
+}
+
+// reserve reserves the testbed and returns the fake device of the DUT. The
+// reservation is released at the end of the test.
+func reserve(t *testing.T, b *Backend, tb *opb.Testbed) *Device {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if _, err := b.ReserveTopology(ctx, tb, time.Minute, 0, nil); err != nil {
+		t.Fatalf("ReserveTopology() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := b.Release(context.Background()); err != nil {
+			t.Errorf("Release() failed: %v", err)
+		}
+	})
+	d, err := b.Device("DUT")
+	if err != nil {
+		t.Fatalf("Device(DUT) failed: %v", err)
+	}
+	return d
+}
+
+func dial(t *testing.T, b *Backend, addr string) *grpc.ClientConn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	conn, err := b.DialGRPC(ctx, addr)
+	if err != nil {
+		t.Fatalf("DialGRPC(%s) failed: %v", addr, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func mustPath(t *testing.T, s string) *gpb.Path {
+	t.Helper()
+	p, err := ygot.StringToStructuredPath(s)
+	if err != nil {
+		t.Fatalf("StringToStructuredPath(%s) failed: %v", s, err)
+	}
+	return p
+}
+
+func jsonUpdate(t *testing.T, path, js string) *gpb.Update {
+	return &gpb.Update{
+		Path: mustPath(t, path),
+		Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(js)}},
+	}
+}
+
+// getString returns the string value of the leaf at path.
+func getString(ctx context.Context, t *testing.T, c gpb.GNMIClient, path string) string {
+	t.Helper()
+	resp, err := c.Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{mustPath(t, path)}, Encoding: gpb.Encoding_PROTO})
+	if err != nil {
+		t.Fatalf("Get(%s) failed: %v", path, err)
+	}
+	if n := resp.GetNotification(); len(n) != 1 || len(n[0].GetUpdate()) != 1 {
+		t.Fatalf("Get(%s) = %v, want a single update", path, resp)
+	}
+	return resp.GetNotification()[0].GetUpdate()[0].GetVal().GetStringVal()
+}
+
+func TestSetGet(t *testing.T) {
+	b := New()
+	d := reserve(t, b, testbed())
+	c := gpb.NewGNMIClient(dial(t, b, d.Addr))
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	const descPath = "/interfaces/interface[name=Ethernet1/1/1]/config/description"
+	const statePath = "/interfaces/interface[name=Ethernet1/1/1]/state/description"
+	if _, err := c.Set(ctx, &gpb.SetRequest{Update: []*gpb.Update{jsonUpdate(t, descPath, `"before"`)}}); err != nil {
+		t.Fatalf("Set(%s) failed: %v", descPath, err)
+	}
+	if got, want := getString(ctx, t, c, statePath), "before"; got != want {
+		t.Errorf("Get(%s) = %q, want %q", statePath, got, want)
+	}
+
+	// The invalid MTU fails the whole request, which must leave the
+	// description of the first update unchanged.
+	_, err := c.Set(ctx, &gpb.SetRequest{Update: []*gpb.Update{
+		jsonUpdate(t, descPath, `"after"`),
+		jsonUpdate(t, "/interfaces/interface[name=Ethernet1/1/1]/config/mtu", `"not a number"`),
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Set(invalid mtu) = %v, want InvalidArgument", err)
+	}
+	if got, want := getString(ctx, t, c, statePath), "before"; got != want {
+		t.Errorf("Get(%s) after failed Set = %q, want %q", statePath, got, want)
+	}
+}
+
+func TestSubscribeStream(t *testing.T) {
+	b := New()
+	d := reserve(t, b, testbed())
+	c := gpb.NewGNMIClient(dial(t, b, d.Addr))
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	stream, err := c.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	if err := stream.Send(&gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+		Mode:         gpb.SubscriptionList_STREAM,
+		Subscription: []*gpb.Subscription{{Path: mustPath(t, "/system/state/hostname")}},
+	}}}); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	// next returns the hostname of the next update, skipping sync responses.
+	next := func() string {
+		t.Helper()
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				t.Fatalf("Recv() failed: %v", err)
+			}
+			if u := resp.GetUpdate().GetUpdate(); len(u) > 0 {
+				return u[0].GetVal().GetStringVal()
+			}
+		}
+	}
+	if got, want := next(), d.Name; got != want {
+		t.Errorf("Initial hostname = %q, want %q", got, want)
+	}
+	d.Update(func(root *oc.Root) {
+		root.GetOrCreateSystem().Hostname = ygot.String("renamed")
+	})
+	if got, want := next(), "renamed"; got != want {
+		t.Errorf("Streamed hostname = %q, want %q", got, want)
+	}
+}
+
+func TestReboot(t *testing.T) {
+	b := New(WithRebootTime(100 * time.Millisecond))
+	d := reserve(t, b, testbed())
+	conn := dial(t, b, d.Addr)
+	sys := syspb.NewSystemClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	bootTime := func() uint64 {
+		t.Helper()
+		resp, err := gpb.NewGNMIClient(conn).Get(ctx, &gpb.GetRequest{Path: []*gpb.Path{mustPath(t, "/system/state/boot-time")}, Encoding: gpb.Encoding_PROTO})
+		if err != nil {
+			t.Fatalf("Get(boot-time) failed: %v", err)
+		}
+		return resp.GetNotification()[0].GetUpdate()[0].GetVal().GetUintVal()
+	}
+	before := bootTime()
+
+	if _, err := sys.Reboot(ctx, &syspb.RebootRequest{Method: syspb.RebootMethod_COLD, Message: "test"}); err != nil {
+		t.Fatalf("Reboot() failed: %v", err)
+	}
+	for {
+		resp, err := sys.RebootStatus(ctx, &syspb.RebootStatusRequest{})
+		if ctx.Err() != nil {
+			t.Fatalf("Device did not come back from the reboot: %v", err)
+		}
+		if err == nil && !resp.GetActive() {
+			if got, want := resp.GetCount(), uint32(1); got != want {
+				t.Errorf("RebootStatus().Count = %v, want %v", got, want)
+			}
+			break
+		}
+		if err != nil && status.Code(err) != codes.Unavailable {
+			t.Fatalf("RebootStatus() = %v, want Unavailable while rebooting", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := bootTime(); after <= before {
+		t.Errorf("Boot time after reboot = %v, want after %v", after, before)
+	}
+}
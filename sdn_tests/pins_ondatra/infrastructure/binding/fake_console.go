@@ -0,0 +1,122 @@
+package fakebackend
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+
+	log "github.com/golang/glog"
+)
+
+// Telnet bytes sent and understood by the console stand-in.
+const (
+	telnetWILL    = 251
+	telnetWONT    = 252
+	telnetDO      = 253
+	telnetDONT    = 254
+	telnetIAC     = 255
+	telnetOptEcho = 1
+	telnetOptSGA  = 3
+)
+
+// consoleServer is a telnet stand-in for the terminal server of a fake
+// device. It negotiates character mode like a terminal server, echoes the
+// input and sends the console messages of the device to all clients.
+type consoleServer struct {
+	lis net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+func startConsole() (*consoleServer, error) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &consoleServer{lis: lis, conns: map[net.Conn]bool{}}
+	go s.serve()
+	return s, nil
+}
+
+func (s *consoleServer) addr() string {
+	return s.lis.Addr().String()
+}
+
+func (s *consoleServer) serve() {
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// handle negotiates the telnet options and echoes the data sent by the
+// client until the connection is closed.
+func (s *consoleServer) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	s.write(conn, []byte{telnetIAC, telnetWILL, telnetOptEcho, telnetIAC, telnetWILL, telnetOptSGA})
+	r := bufio.NewReader(conn)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		if b == telnetIAC {
+			cmd, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			switch cmd {
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				if _, err := r.ReadByte(); err != nil {
+					return
+				}
+				continue
+			case telnetIAC:
+				s.write(conn, []byte{telnetIAC, telnetIAC})
+			}
+			continue
+		}
+		s.write(conn, []byte{b})
+	}
+}
+
+func (s *consoleServer) write(conn net.Conn, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := conn.Write(data); err != nil {
+		log.Warningf("Failed to write to console client %v: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// printf sends a console message to all connected clients.
+func (s *consoleServer) printf(format string, args ...any) {
+	msg := []byte(fmt.Sprintf(format, args...))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Write(msg)
+	}
+}
+
+func (s *consoleServer) stop() {
+	s.lis.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,101 @@
+package fakebackend
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openconfig/ondatra/binding"
+
+	syspb "github.com/openconfig/gnoi/system"
+)
+
+// consoleReader collects the console output read in the background.
+type consoleReader struct {
+	out  chan string
+	done chan error
+}
+
+func readConsole(r io.Reader) *consoleReader {
+	c := &consoleReader{out: make(chan string, 100), done: make(chan error, 1)}
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				c.out <- string(buf[:n])
+			}
+			if err != nil {
+				c.done <- err
+				return
+			}
+		}
+	}()
+	return c
+}
+
+// waitFor reads the console output until it contains want.
+func (c *consoleReader) waitFor(t *testing.T, want string) {
+	t.Helper()
+	var got strings.Builder
+	timeout := time.After(testTimeout)
+	for !strings.Contains(got.String(), want) {
+		select {
+		case s := <-c.out:
+			got.WriteString(s)
+		case err := <-c.done:
+			t.Fatalf("Console closed before %q was read: %v, read %q", want, err, got.String())
+		case <-timeout:
+			t.Fatalf("Console output %q does not contain %q", got.String(), want)
+		}
+	}
+}
+
+func TestDialConsole(t *testing.T) {
+	b := New(WithRebootTime(100 * time.Millisecond))
+	d := reserve(t, b, testbed())
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	console, err := b.DialConsole(ctx, &binding.AbstractDUT{Dims: &binding.Dims{Name: d.Name}})
+	if err != nil {
+		t.Fatalf("DialConsole() failed: %v", err)
+	}
+	r := readConsole(console.Stdout())
+
+	// The telnet negotiation is answered by the client and removed from the
+	// output, so the echo is read back as is.
+	if _, err := console.Stdin().Write([]byte("show version\n")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	r.waitFor(t, "show version\n")
+
+	sys := syspb.NewSystemClient(dial(t, b, d.Addr))
+	if _, err := sys.Reboot(ctx, &syspb.RebootRequest{Method: syspb.RebootMethod_COLD, Message: "test"}); err != nil {
+		t.Fatalf("Reboot() failed: %v", err)
+	}
+	r.waitFor(t, "going down for reboot")
+	r.waitFor(t, d.Name+" login:")
+
+	if err := console.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	select {
+	case err := <-r.done:
+		if err == nil {
+			t.Errorf("Read() after Close() succeeded, want an error")
+		}
+	case <-time.After(testTimeout):
+		t.Errorf("Read() did not return after Close()")
+	}
+}
+
+func TestDialConsoleUnknownDevice(t *testing.T) {
+	b := New()
+	reserve(t, b, testbed())
+	if _, err := b.DialConsole(context.Background(), &binding.AbstractDUT{Dims: &binding.Dims{Name: "unknown"}}); err == nil {
+		t.Errorf("DialConsole(unknown) succeeded, want an error")
+	}
+}
@@ -0,0 +1,408 @@
+package fakebackend
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/ygot/ygot"
+	"github.com/openconfig/ygot/ytypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// gnmiServer serves gNMI from the OpenConfig datastore of a fake device.
+// Configuration and state share the datastore, so a config path and the
+// matching state path always hold the same value.
+type gnmiServer struct {
+	gpb.UnimplementedGNMIServer
+	dev *Device
+}
+
+func (s *gnmiServer) Capabilities(ctx context.Context, req *gpb.CapabilityRequest) (*gpb.CapabilityResponse, error) {
+	return &gpb.CapabilityResponse{
+		SupportedEncodings: []gpb.Encoding{gpb.Encoding_JSON_IETF, gpb.Encoding_PROTO},
+		GNMIVersion:        "0.10.0",
+	}, nil
+}
+
+func (s *gnmiServer) Get(ctx context.Context, req *gpb.GetRequest) (*gpb.GetResponse, error) {
+	paths := req.GetPath()
+	if len(paths) == 0 {
+		paths = []*gpb.Path{{}}
+	}
+
+	s.dev.mu.Lock()
+	defer s.dev.mu.Unlock()
+	ts := time.Now().UnixNano()
+	resp := &gpb.GetResponse{}
+	for _, p := range paths {
+		path := fullPath(req.GetPrefix(), p)
+		switch req.GetEncoding() {
+		case gpb.Encoding_JSON, gpb.Encoding_JSON_IETF:
+			js, err := s.dev.jsonAt(path)
+			if err != nil {
+				return nil, err
+			}
+			resp.Notification = append(resp.Notification, &gpb.Notification{
+				Timestamp: ts,
+				Update: []*gpb.Update{{
+					Path: p,
+					Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: js}},
+				}},
+			})
+		default:
+			leaves, err := s.dev.leaves()
+			if err != nil {
+				return nil, err
+			}
+			n := &gpb.Notification{Timestamp: ts, Prefix: &gpb.Path{Origin: "openconfig", Target: req.GetPrefix().GetTarget()}}
+			for _, leaf := range leaves {
+				if lp, ok := matchPath(path, leaf.GetPath()); ok {
+					n.Update = append(n.Update, &gpb.Update{Path: lp, Val: leaf.GetVal()})
+				}
+			}
+			if len(n.GetUpdate()) == 0 {
+				return nil, status.Errorf(codes.NotFound, "no data at %v", path)
+			}
+			resp.Notification = append(resp.Notification, n)
+		}
+	}
+	return resp, nil
+}
+
+// Set applies the request atomically. Replace is handled like Update: the
+// fake merges the value into the datastore and does not remove leaves that
+// are missing from it.
+func (s *gnmiServer) Set(ctx context.Context, req *gpb.SetRequest) (*gpb.SetResponse, error) {
+	s.dev.mu.Lock()
+	backup, err := ygot.DeepCopy(s.dev.root())
+	if err != nil {
+		s.dev.mu.Unlock()
+		return nil, status.Errorf(codes.Internal, "failed to copy datastore: %v", err)
+	}
+
+	resp := &gpb.SetResponse{Prefix: req.GetPrefix()}
+	err = func() error {
+		for _, p := range req.GetDelete() {
+			s.dev.deleteAt(fullPath(req.GetPrefix(), p))
+			resp.Response = append(resp.Response, &gpb.UpdateResult{Path: p, Op: gpb.UpdateResult_DELETE})
+		}
+		for _, up := range req.GetReplace() {
+			if err := s.dev.setAt(fullPath(req.GetPrefix(), up.GetPath()), up.GetVal()); err != nil {
+				return err
+			}
+			resp.Response = append(resp.Response, &gpb.UpdateResult{Path: up.GetPath(), Op: gpb.UpdateResult_REPLACE})
+		}
+		for _, up := range req.GetUpdate() {
+			if err := s.dev.setAt(fullPath(req.GetPrefix(), up.GetPath()), up.GetVal()); err != nil {
+				return err
+			}
+			resp.Response = append(resp.Response, &gpb.UpdateResult{Path: up.GetPath(), Op: gpb.UpdateResult_UPDATE})
+		}
+		return nil
+	}()
+	if err != nil {
+		s.dev.schema.Root = backup
+		s.dev.mu.Unlock()
+		return nil, err
+	}
+	s.dev.mu.Unlock()
+
+	s.dev.notify()
+	resp.Timestamp = time.Now().UnixNano()
+	return resp, nil
+}
+
+func (s *gnmiServer) Subscribe(stream gpb.GNMI_SubscribeServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	sub := req.GetSubscribe()
+	if sub == nil {
+		return status.Errorf(codes.InvalidArgument, "first SubscribeRequest must contain a SubscriptionList")
+	}
+
+	var queries []*gpb.Path
+	for _, subscription := range sub.GetSubscription() {
+		queries = append(queries, fullPath(sub.GetPrefix(), subscription.GetPath()))
+	}
+	if len(queries) == 0 {
+		queries = append(queries, fullPath(sub.GetPrefix(), &gpb.Path{}))
+	}
+	prefix := &gpb.Path{Origin: "openconfig", Target: sub.GetPrefix().GetTarget()}
+
+	// Track the sent values to only stream changes.
+	sent := map[string]*gpb.TypedValue{}
+	update := func(send bool) error {
+		s.dev.mu.Lock()
+		leaves, err := s.dev.leaves()
+		s.dev.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		n := &gpb.Notification{Timestamp: time.Now().UnixNano(), Prefix: prefix}
+		current := map[string]bool{}
+		for _, leaf := range leaves {
+			for _, q := range queries {
+				lp, ok := matchPath(q, leaf.GetPath())
+				if !ok {
+					continue
+				}
+				key, err := ygot.PathToString(lp)
+				if err != nil {
+					return status.Errorf(codes.Internal, "invalid path %v: %v", lp, err)
+				}
+				current[key] = true
+				if old, ok := sent[key]; !ok || !proto.Equal(old, leaf.GetVal()) {
+					sent[key] = leaf.GetVal()
+					n.Update = append(n.Update, &gpb.Update{Path: lp, Val: leaf.GetVal()})
+				}
+				break
+			}
+		}
+		for key := range sent {
+			if current[key] {
+				continue
+			}
+			delete(sent, key)
+			p, err := ygot.StringToStructuredPath(key)
+			if err != nil {
+				return status.Errorf(codes.Internal, "invalid path %s: %v", key, err)
+			}
+			n.Delete = append(n.Delete, p)
+		}
+
+		if !send || (len(n.GetUpdate()) == 0 && len(n.GetDelete()) == 0) {
+			return nil
+		}
+		return stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: n}})
+	}
+	syncResponse := func() error {
+		return stream.Send(&gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}})
+	}
+
+	if err := update(!sub.GetUpdatesOnly()); err != nil {
+		return err
+	}
+	if err := syncResponse(); err != nil {
+		return err
+	}
+
+	switch sub.GetMode() {
+	case gpb.SubscriptionList_ONCE:
+		return nil
+	case gpb.SubscriptionList_POLL:
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if req.GetPoll() == nil {
+				return status.Errorf(codes.InvalidArgument, "expected Poll request, got %v", req)
+			}
+			sent = map[string]*gpb.TypedValue{}
+			if err := update(true); err != nil {
+				return err
+			}
+			if err := syncResponse(); err != nil {
+				return err
+			}
+		}
+	default:
+		ch := make(chan struct{}, 1)
+		s.dev.mu.Lock()
+		s.dev.subs[ch] = true
+		s.dev.mu.Unlock()
+		defer func() {
+			s.dev.mu.Lock()
+			delete(s.dev.subs, ch)
+			s.dev.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			case <-ch:
+				if err := update(true); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// fullPath joins the prefix and the path elements.
+func fullPath(prefix, path *gpb.Path) *gpb.Path {
+	var elems []*gpb.PathElem
+	elems = append(elems, prefix.GetElem()...)
+	elems = append(elems, path.GetElem()...)
+	return &gpb.Path{Elem: elems}
+}
+
+// matchPath returns whether the leaf path is at or below the query path,
+// which may contain wildcards. A "config" element of the query matches a
+// "state" element of the leaf, and the returned leaf path is spelled like the
+// query so that config queries receive config paths.
+func matchPath(query, leaf *gpb.Path) (*gpb.Path, bool) {
+	qe, le := query.GetElem(), leaf.GetElem()
+	if len(qe) > len(le) {
+		return nil, false
+	}
+
+	elems := make([]*gpb.PathElem, len(le))
+	copy(elems, le)
+	for i, q := range qe {
+		name := le[i].GetName()
+		switch {
+		case q.GetName() == "*" || q.GetName() == name:
+		case q.GetName() == "config" && name == "state":
+			name = "config"
+		default:
+			return nil, false
+		}
+		for k, v := range q.GetKey() {
+			if v != "*" && le[i].GetKey()[k] != v {
+				return nil, false
+			}
+		}
+		elems[i] = &gpb.PathElem{Name: name, Key: le[i].GetKey()}
+	}
+	return &gpb.Path{Elem: elems}, true
+}
+
+// leaves returns every populated leaf of the datastore. Callers must hold mu.
+func (d *Device) leaves() ([]*gpb.Update, error) {
+	notifs, err := ygot.TogNMINotifications(d.root(), time.Now().UnixNano(), ygot.GNMINotificationsConfig{UsePathElem: true})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to render datastore: %v", err)
+	}
+	var leaves []*gpb.Update
+	for _, n := range notifs {
+		for _, up := range n.GetUpdate() {
+			var elems []*gpb.PathElem
+			elems = append(elems, n.GetPrefix().GetElem()...)
+			elems = append(elems, up.GetPath().GetElem()...)
+			leaves = append(leaves, &gpb.Update{Path: &gpb.Path{Elem: elems}, Val: up.GetVal()})
+		}
+	}
+	return leaves, nil
+}
+
+// jsonAt returns the RFC7951 JSON of the datastore node at path. Callers must
+// hold mu.
+func (d *Device) jsonAt(path *gpb.Path) ([]byte, error) {
+	cfg := &ygot.RFC7951JSONConfig{AppendModuleName: true, PreferShadowPath: true}
+	if len(path.GetElem()) == 0 {
+		return ygot.Marshal7951(d.root(), cfg)
+	}
+	nodes, err := ytypes.GetNode(d.schema.RootSchema(), d.root(), path, &ytypes.PreferShadowPath{})
+	if err != nil || len(nodes) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no data at %v: %v", path, err)
+	}
+	return ygot.Marshal7951(nodes[0].Data, cfg)
+}
+
+// deleteAt removes the node at path. Deleting a missing node is not an error.
+// Callers must hold mu.
+func (d *Device) deleteAt(path *gpb.Path) {
+	if err := ytypes.DeleteNode(d.schema.RootSchema(), d.root(), path, &ytypes.PreferShadowPath{}); err != nil {
+		log.Infof("Fake device %s ignoring delete of %v: %v", d.Name, path, err)
+	}
+}
+
+// setAt merges the value into the datastore at path. Callers must hold mu.
+func (d *Device) setAt(path *gpb.Path, val *gpb.TypedValue) error {
+	js := val.GetJsonIetfVal()
+	if js == nil {
+		js = val.GetJsonVal()
+	}
+	if js == nil {
+		if val.GetValue() == nil {
+			d.deleteAt(path)
+			return nil
+		}
+		if err := ytypes.SetNode(d.schema.RootSchema(), d.root(), path, val, &ytypes.InitMissingElements{}, &ytypes.PreferShadowPath{}); err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to set %v: %v", path, err)
+		}
+		return nil
+	}
+
+	elems := path.GetElem()
+	if len(elems) == 0 {
+		if err := d.schema.Unmarshal(js, d.root(), &ytypes.PreferShadowPath{}); err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to set root: %v", err)
+		}
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal(js, &v); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid JSON value for %v: %v", path, err)
+	}
+	v = unwrapValue(elems[len(elems)-1], v)
+
+	// Nest the value below the closest list entry, or the root, since the
+	// compressed OpenConfig structs have no nodes for containers such as
+	// "config".
+	entry := -1
+	for i, e := range elems {
+		if len(e.GetKey()) > 0 {
+			entry = i
+		}
+	}
+	for i := len(elems) - 1; i > entry; i-- {
+		v = map[string]any{elems[i].GetName(): v}
+	}
+	nested, err := json.Marshal(v)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to marshal value for %v: %v", path, err)
+	}
+
+	if entry < 0 {
+		err = d.schema.Unmarshal(nested, d.root(), &ytypes.PreferShadowPath{})
+	} else {
+		err = ytypes.SetNode(d.schema.RootSchema(), d.root(), &gpb.Path{Elem: elems[:entry+1]},
+			&gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: nested}},
+			&ytypes.InitMissingElements{}, &ytypes.PreferShadowPath{})
+	}
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to set %v: %v", path, err)
+	}
+	return nil
+}
+
+// unwrapValue removes the container that PINS expects around JSON_IETF
+// values, see wrapValueInUpdate in pinsbind, e.g.
+// - {"foo": 123} -> 123
+// - {"foo": [{"str": "one"}]} -> {"str": "one"} for list entry paths
+func unwrapValue(elem *gpb.PathElem, v any) any {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return v
+	}
+	for k, inner := range m {
+		if _, name, found := strings.Cut(k, ":"); found {
+			k = name
+		}
+		if k != elem.GetName() {
+			return v
+		}
+		if arr, ok := inner.([]any); ok && len(elem.GetKey()) > 0 && len(arr) == 1 {
+			return arr[0]
+		}
+		return inner
+	}
+	return v
+}
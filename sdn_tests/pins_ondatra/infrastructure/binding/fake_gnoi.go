@@ -0,0 +1,102 @@
+package fakebackend
+
+import (
+	"context"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	syspb "github.com/openconfig/gnoi/system"
+)
+
+// systemServer implements the gNOI System service of a fake device.
+type systemServer struct {
+	syspb.UnimplementedSystemServer
+	dev *Device
+}
+
+func (s *systemServer) Time(ctx context.Context, req *syspb.TimeRequest) (*syspb.TimeResponse, error) {
+	return &syspb.TimeResponse{Time: uint64(time.Now().UnixNano())}, nil
+}
+
+// Reboot schedules a reboot after the requested delay. While rebooting, the
+// device rejects all RPCs with Unavailable. It comes back with a new boot time
+// unless the reboot is NSF, and with its ports flapped unless the reboot is
+// WARM or NSF.
+func (s *systemServer) Reboot(ctx context.Context, req *syspb.RebootRequest) (*syspb.RebootResponse, error) {
+	d := s.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.reboot.GetActive() {
+		return nil, status.Errorf(codes.FailedPrecondition, "reboot of %s is already in progress", d.Name)
+	}
+
+	delay := time.Duration(req.GetDelay())
+	d.reboot = &syspb.RebootStatusResponse{
+		Active: true,
+		When:   uint64(time.Now().Add(delay).UnixNano()),
+		Reason: req.GetMessage(),
+		Count:  d.reboot.GetCount() + 1,
+		Method: req.GetMethod(),
+	}
+	d.rebootTimer = time.AfterFunc(delay, d.rebootNow)
+	log.Infof("Fake device %s rebooting in %v: %s", d.Name, delay, req.GetMessage())
+	return &syspb.RebootResponse{}, nil
+}
+
+// RebootStatus reports the state of the latest reboot request.
+func (s *systemServer) RebootStatus(ctx context.Context, req *syspb.RebootStatusRequest) (*syspb.RebootStatusResponse, error) {
+	s.dev.mu.Lock()
+	defer s.dev.mu.Unlock()
+	return proto.Clone(s.dev.reboot).(*syspb.RebootStatusResponse), nil
+}
+
+// CancelReboot cancels a delayed reboot that has not started yet.
+func (s *systemServer) CancelReboot(ctx context.Context, req *syspb.CancelRebootRequest) (*syspb.CancelRebootResponse, error) {
+	d := s.dev
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.rebootTimer == nil || !d.rebootTimer.Stop() {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s has no pending reboot", d.Name)
+	}
+	d.rebootTimer = nil
+	d.reboot.Active = false
+	log.Infof("Fake device %s cancelled reboot: %s", d.Name, req.GetMessage())
+	return &syspb.CancelRebootResponse{}, nil
+}
+
+// rebootNow takes the device down for the configured reboot time.
+func (d *Device) rebootNow() {
+	d.mu.Lock()
+	d.rebooting = true
+	d.rebootTimer = nil
+	d.mu.Unlock()
+	d.console.printf("\r\nThe system is going down for reboot NOW!\r\n")
+
+	time.Sleep(d.rebootTime)
+
+	d.mu.Lock()
+	d.rebooting = false
+	d.reboot.Active = false
+	if d.osNext != "" {
+		d.osVersion, d.osNext = d.osNext, ""
+	}
+	now := uint64(time.Now().UnixNano())
+	method := d.reboot.GetMethod()
+	if method != syspb.RebootMethod_NSF {
+		d.root().GetOrCreateSystem().BootTime = ygot.Uint64(now)
+	}
+	if method != syspb.RebootMethod_WARM && method != syspb.RebootMethod_NSF {
+		for _, intf := range d.root().Interface {
+			intf.LastChange = ygot.Uint64(now)
+		}
+	}
+	d.mu.Unlock()
+	d.notify()
+	d.console.printf("\r\n%s login: ", d.Name)
+	log.Infof("Fake device %s is back up", d.Name)
+}
@@ -0,0 +1,166 @@
+package fakebackend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+
+	log "github.com/golang/glog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ospb "github.com/openconfig/gnoi/os"
+	syspb "github.com/openconfig/gnoi/system"
+	tpb "github.com/openconfig/gnoi/types"
+)
+
+// fakeOSVersion is the OS version a fake device boots with.
+const fakeOSVersion = "fake-os-1.0"
+
+// osServer implements the gNOI OS service of a fake device. Installed images
+// are kept by version with the SHA256 of their contents, and the activated
+// version runs after the next reboot.
+type osServer struct {
+	ospb.UnimplementedOSServer
+	dev *Device
+}
+
+// Install receives an image. A version that is already installed is validated
+// right away, an empty image fails to parse and an image not matching the
+// SHA256 of the transfer request fails the integrity check.
+func (s *osServer) Install(stream ospb.OS_InstallServer) error {
+	d := s.dev
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	version := req.GetTransferRequest().GetVersion()
+	if version == "" {
+		return status.Errorf(codes.InvalidArgument, "first install request must be a transfer request with a version")
+	}
+	want := req.GetTransferRequest().GetHash()
+	if want != nil && want.GetMethod() != tpb.HashType_SHA256 {
+		return status.Errorf(codes.InvalidArgument, "unsupported hash method %v", want.GetMethod())
+	}
+
+	d.mu.Lock()
+	_, installed := d.osImages[version]
+	busy := d.osInstalling
+	if !installed && !busy {
+		d.osInstalling = true
+	}
+	d.mu.Unlock()
+	switch {
+	case installed:
+		return stream.Send(&ospb.InstallResponse{Response: &ospb.InstallResponse_Validated{Validated: &ospb.Validated{Version: version}}})
+	case busy:
+		return sendInstallError(stream, ospb.InstallError_INSTALL_IN_PROGRESS, "another install is in progress")
+	}
+	defer func() {
+		d.mu.Lock()
+		d.osInstalling = false
+		d.mu.Unlock()
+	}()
+	if err := stream.Send(&ospb.InstallResponse{Response: &ospb.InstallResponse_TransferReady{TransferReady: &ospb.TransferReady{}}}); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	received, err := receiveImage(stream, h)
+	if err != nil {
+		return err
+	}
+	if received == 0 {
+		return sendInstallError(stream, ospb.InstallError_PARSE_FAIL, "image is empty")
+	}
+	if want != nil && !bytes.Equal(h.Sum(nil), want.GetHash()) {
+		return sendInstallError(stream, ospb.InstallError_INTEGRITY_FAIL, fmt.Sprintf("image sha256 %x, want %x", h.Sum(nil), want.GetHash()))
+	}
+	d.mu.Lock()
+	d.osImages[version] = fmt.Sprintf("%x", h.Sum(nil))
+	d.mu.Unlock()
+	log.Infof("Fake device %s installed OS version %s (%d bytes)", d.Name, version, received)
+	return stream.Send(&ospb.InstallResponse{Response: &ospb.InstallResponse_Validated{Validated: &ospb.Validated{Version: version}}})
+}
+
+// receiveImage hashes the transferred contents until the transfer end and
+// reports the progress of the transfer.
+func receiveImage(stream ospb.OS_InstallServer, h hash.Hash) (uint64, error) {
+	var received uint64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return 0, status.Errorf(codes.Aborted, "stream closed before the transfer end")
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch r := req.GetRequest().(type) {
+		case *ospb.InstallRequest_TransferContent:
+			h.Write(r.TransferContent)
+			received += uint64(len(r.TransferContent))
+			if err := stream.Send(&ospb.InstallResponse{Response: &ospb.InstallResponse_TransferProgress{TransferProgress: &ospb.TransferProgress{BytesReceived: received}}}); err != nil {
+				return 0, err
+			}
+		case *ospb.InstallRequest_TransferEnd:
+			return received, nil
+		default:
+			return 0, status.Errorf(codes.InvalidArgument, "unexpected install request %T during the transfer", r)
+		}
+	}
+}
+
+func sendInstallError(stream ospb.OS_InstallServer, t ospb.InstallError_Type, detail string) error {
+	return stream.Send(&ospb.InstallResponse{Response: &ospb.InstallResponse_InstallError{InstallError: &ospb.InstallError{Type: t, Detail: detail}}})
+}
+
+// Activate sets the version to run after the next reboot, and reboots the
+// device unless NoReboot is set.
+func (s *osServer) Activate(ctx context.Context, req *ospb.ActivateRequest) (*ospb.ActivateResponse, error) {
+	d := s.dev
+	d.mu.Lock()
+	_, installed := d.osImages[req.GetVersion()]
+	if installed {
+		d.osNext = req.GetVersion()
+	}
+	d.mu.Unlock()
+	if !installed {
+		return &ospb.ActivateResponse{Response: &ospb.ActivateResponse_ActivateError{ActivateError: &ospb.ActivateError{
+			Type:   ospb.ActivateError_NON_EXISTENT_VERSION,
+			Detail: fmt.Sprintf("version %s is not installed", req.GetVersion()),
+		}}}, nil
+	}
+	log.Infof("Fake device %s activated OS version %s", d.Name, req.GetVersion())
+	if !req.GetNoReboot() {
+		sys := &systemServer{dev: d}
+		if _, err := sys.Reboot(ctx, &syspb.RebootRequest{Method: syspb.RebootMethod_COLD, Message: "OS activation"}); err != nil {
+			return nil, err
+		}
+	}
+	return &ospb.ActivateResponse{Response: &ospb.ActivateResponse_ActivateOk{ActivateOk: &ospb.ActivateOK{}}}, nil
+}
+
+// Verify returns the running version.
+func (s *osServer) Verify(ctx context.Context, req *ospb.VerifyRequest) (*ospb.VerifyResponse, error) {
+	s.dev.mu.Lock()
+	defer s.dev.mu.Unlock()
+	return &ospb.VerifyResponse{Version: s.dev.osVersion}, nil
+}
+
+// OSVersion returns the OS version the device runs.
+func (d *Device) OSVersion() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.osVersion
+}
+
+// OSImageHash returns the SHA256 of the image installed for the version.
+func (d *Device) OSImageHash(version string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h, ok := d.osImages[version]
+	return h, ok
+}
@@ -0,0 +1,84 @@
+package fakebackend
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	ospb "github.com/openconfig/gnoi/os"
+	tpb "github.com/openconfig/gnoi/types"
+)
+
+// install streams the image to the fake device and returns its final
+// response.
+func install(ctx context.Context, t *testing.T, c ospb.OSClient, version string, hash, image []byte) *ospb.InstallResponse {
+	t.Helper()
+	stream, err := c.Install(ctx)
+	if err != nil {
+		t.Fatalf("Install() failed: %v", err)
+	}
+	send := func(req *ospb.InstallRequest) {
+		t.Helper()
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("Send() failed: %v", err)
+		}
+	}
+	recv := func() *ospb.InstallResponse {
+		t.Helper()
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() failed: %v", err)
+		}
+		return resp
+	}
+	send(&ospb.InstallRequest{Request: &ospb.InstallRequest_TransferRequest{TransferRequest: &ospb.TransferRequest{
+		Version: version,
+		Hash:    &tpb.HashType{Method: tpb.HashType_SHA256, Hash: hash},
+	}}})
+	if resp := recv(); resp.GetTransferReady() == nil {
+		return resp
+	}
+	send(&ospb.InstallRequest{Request: &ospb.InstallRequest_TransferContent{TransferContent: image}})
+	send(&ospb.InstallRequest{Request: &ospb.InstallRequest_TransferEnd{TransferEnd: &ospb.TransferEnd{}}})
+	for {
+		if resp := recv(); resp.GetTransferProgress() == nil {
+			return resp
+		}
+	}
+}
+
+func TestInstallHash(t *testing.T) {
+	b := New()
+	d := reserve(t, b, testbed())
+	c := ospb.NewOSClient(dial(t, b, d.Addr))
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	image := []byte("image")
+	sum := sha256.Sum256(image)
+	tests := []struct {
+		desc    string
+		version string
+		hash    []byte
+		want    ospb.InstallError_Type // UNSPECIFIED if the image is validated
+	}{
+		{"matching hash", "good", sum[:], ospb.InstallError_UNSPECIFIED},
+		{"mismatching hash", "corrupted", []byte("not the hash"), ospb.InstallError_INTEGRITY_FAIL},
+	}
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			resp := install(ctx, t, c, tc.version, tc.hash, image)
+			if got := resp.GetInstallError().GetType(); got != tc.want {
+				t.Fatalf("Install(%v) = %v, want install error %v", tc.version, resp, tc.want)
+			}
+			_, installed := d.OSImageHash(tc.version)
+			if want := tc.want == ospb.InstallError_UNSPECIFIED; installed != want {
+				t.Errorf("Version %v installed = %v, want %v", tc.version, installed, want)
+			}
+		})
+	}
+	if got, _ := d.OSImageHash("good"); got != fmt.Sprintf("%x", sum) {
+		t.Errorf("OSImageHash(good) = %v, want %x", got, sum)
+	}
+}
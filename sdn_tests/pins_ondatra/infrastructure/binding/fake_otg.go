@@ -0,0 +1,160 @@
+package fakebackend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	otg "github.com/open-traffic-generator/snappi/gosnappi/otg"
+)
+
+// continuousFrames is the number of frames reported for a flow without a
+// fixed packet count once its traffic was started.
+const continuousFrames = 1000
+
+// ATE is a fake traffic generator serving OTG on a loopback address. It does
+// not send packets, every started flow reports all its frames as transmitted
+// and received.
+type ATE struct {
+	Name string
+	Addr string
+
+	server *grpc.Server
+
+	mu     sync.Mutex
+	config *otg.Config
+	// frames contains the frames sent by every started flow.
+	frames map[string]uint64
+	// transmitting contains the flows that are currently started.
+	transmitting map[string]bool
+}
+
+func startATE(name string) (*ATE, error) {
+	a := &ATE{
+		Name:         name,
+		config:       &otg.Config{},
+		frames:       map[string]uint64{},
+		transmitting: map[string]bool{},
+	}
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for fake ATE %s: %v", name, err)
+	}
+	a.Addr = lis.Addr().String()
+	a.server = grpc.NewServer()
+	otg.RegisterOpenapiServer(a.server, &otgServer{ate: a})
+	go a.server.Serve(lis)
+	return a, nil
+}
+
+func (a *ATE) stop() {
+	a.server.Stop()
+}
+
+// Config returns the OTG configuration pushed to the fake ATE.
+func (a *ATE) Config() *otg.Config {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return proto.Clone(a.config).(*otg.Config)
+}
+
+// otgServer implements the configuration, traffic control and metrics parts
+// of the OTG service.
+type otgServer struct {
+	otg.UnimplementedOpenapiServer
+	ate *ATE
+}
+
+func (s *otgServer) SetConfig(ctx context.Context, req *otg.SetConfigRequest) (*otg.SetConfigResponse, error) {
+	s.ate.mu.Lock()
+	defer s.ate.mu.Unlock()
+	s.ate.config = proto.Clone(req.GetConfig()).(*otg.Config)
+	s.ate.frames = map[string]uint64{}
+	s.ate.transmitting = map[string]bool{}
+	return &otg.SetConfigResponse{}, nil
+}
+
+func (s *otgServer) GetConfig(ctx context.Context, req *emptypb.Empty) (*otg.GetConfigResponse, error) {
+	return &otg.GetConfigResponse{Config: s.ate.Config()}, nil
+}
+
+func (s *otgServer) SetControlState(ctx context.Context, req *otg.SetControlStateRequest) (*otg.SetControlStateResponse, error) {
+	transmit := req.GetControlState().GetTraffic().GetFlowTransmit()
+	if transmit == nil {
+		// Port and protocol states have no effect on the fake.
+		return &otg.SetControlStateResponse{}, nil
+	}
+
+	s.ate.mu.Lock()
+	defer s.ate.mu.Unlock()
+	names := map[string]bool{}
+	for _, name := range transmit.GetFlowNames() {
+		names[name] = true
+	}
+	for _, flow := range s.ate.config.GetFlows() {
+		if len(names) > 0 && !names[flow.GetName()] {
+			continue
+		}
+		switch transmit.GetState() {
+		case otg.StateTrafficFlowTransmit_State_start:
+			frames := uint64(continuousFrames)
+			if fixed := flow.GetDuration().GetFixedPackets(); fixed != nil {
+				frames = uint64(fixed.GetPackets())
+			}
+			s.ate.frames[flow.GetName()] += frames
+			s.ate.transmitting[flow.GetName()] = true
+		case otg.StateTrafficFlowTransmit_State_stop:
+			s.ate.transmitting[flow.GetName()] = false
+		default:
+			return nil, status.Errorf(codes.Unimplemented, "flow transmit state %v is not supported by the fake ATE", transmit.GetState())
+		}
+	}
+	return &otg.SetControlStateResponse{}, nil
+}
+
+func (s *otgServer) GetMetrics(ctx context.Context, req *otg.GetMetricsRequest) (*otg.GetMetricsResponse, error) {
+	s.ate.mu.Lock()
+	defer s.ate.mu.Unlock()
+	mreq := req.GetMetricsRequest()
+	resp := &otg.MetricsResponse{}
+	switch {
+	case mreq.GetFlow() != nil:
+		resp.Choice = otg.MetricsResponse_Choice_flow_metrics.Enum()
+		for _, flow := range s.ate.config.GetFlows() {
+			transmit := otg.FlowMetric_Transmit_stopped
+			if s.ate.transmitting[flow.GetName()] {
+				transmit = otg.FlowMetric_Transmit_started
+			}
+			frames := s.ate.frames[flow.GetName()]
+			resp.FlowMetrics = append(resp.FlowMetrics, &otg.FlowMetric{
+				Name:     proto.String(flow.GetName()),
+				Transmit: transmit.Enum(),
+				FramesTx: proto.Uint64(frames),
+				FramesRx: proto.Uint64(frames),
+			})
+		}
+	case mreq.GetPort() != nil:
+		resp.Choice = otg.MetricsResponse_Choice_port_metrics.Enum()
+		tx := map[string]uint64{}
+		for _, flow := range s.ate.config.GetFlows() {
+			tx[flow.GetTxRx().GetPort().GetTxName()] += s.ate.frames[flow.GetName()]
+		}
+		for _, port := range s.ate.config.GetPorts() {
+			resp.PortMetrics = append(resp.PortMetrics, &otg.PortMetric{
+				Name:     proto.String(port.GetName()),
+				Link:     otg.PortMetric_Link_up.Enum(),
+				FramesTx: proto.Uint64(tx[port.GetName()]),
+			})
+		}
+	default:
+		return nil, status.Errorf(codes.Unimplemented, "metrics request %v is not supported by the fake ATE", mreq.GetChoice())
+	}
+	return &otg.GetMetricsResponse{MetricsResponse: resp}, nil
+}
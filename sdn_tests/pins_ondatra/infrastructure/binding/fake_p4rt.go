@@ -0,0 +1,73 @@
+package fakebackend
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc/codes"
+
+	p4pb "github.com/p4lang/p4runtime/go/p4/v1"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// p4rtServer implements a minimal P4Runtime service. Every client is granted
+// primary arbitration, writes are accepted and dropped, and the forwarding
+// pipeline config is stored as is.
+type p4rtServer struct {
+	p4pb.UnimplementedP4RuntimeServer
+	dev *Device
+}
+
+func (s *p4rtServer) Capabilities(ctx context.Context, req *p4pb.CapabilitiesRequest) (*p4pb.CapabilitiesResponse, error) {
+	return &p4pb.CapabilitiesResponse{P4RuntimeApiVersion: "1.3.0"}, nil
+}
+
+func (s *p4rtServer) Write(ctx context.Context, req *p4pb.WriteRequest) (*p4pb.WriteResponse, error) {
+	return &p4pb.WriteResponse{}, nil
+}
+
+func (s *p4rtServer) Read(req *p4pb.ReadRequest, stream p4pb.P4Runtime_ReadServer) error {
+	return stream.Send(&p4pb.ReadResponse{})
+}
+
+func (s *p4rtServer) SetForwardingPipelineConfig(ctx context.Context, req *p4pb.SetForwardingPipelineConfigRequest) (*p4pb.SetForwardingPipelineConfigResponse, error) {
+	s.dev.mu.Lock()
+	defer s.dev.mu.Unlock()
+	s.dev.p4Config = req.GetConfig()
+	return &p4pb.SetForwardingPipelineConfigResponse{}, nil
+}
+
+func (s *p4rtServer) GetForwardingPipelineConfig(ctx context.Context, req *p4pb.GetForwardingPipelineConfigRequest) (*p4pb.GetForwardingPipelineConfigResponse, error) {
+	s.dev.mu.Lock()
+	defer s.dev.mu.Unlock()
+	return &p4pb.GetForwardingPipelineConfigResponse{Config: s.dev.p4Config}, nil
+}
+
+func (s *p4rtServer) StreamChannel(stream p4pb.P4Runtime_StreamChannelServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		arb := req.GetArbitration()
+		if arb == nil {
+			continue
+		}
+		err = stream.Send(&p4pb.StreamMessageResponse{
+			Update: &p4pb.StreamMessageResponse_Arbitration{
+				Arbitration: &p4pb.MasterArbitrationUpdate{
+					DeviceId:   arb.GetDeviceId(),
+					Role:       arb.GetRole(),
+					ElectionId: arb.GetElectionId(),
+					Status:     &spb.Status{Code: int32(codes.OK)},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
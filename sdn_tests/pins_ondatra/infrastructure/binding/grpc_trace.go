@@ -0,0 +1,118 @@
+// Package grpctrace records the gRPC traffic of the binding to trace files and
+// replays it from them.
+//
+// A trace directory contains one <test name>.trace file per test and a
+// main.trace file for traffic outside of tests. Every file is a sequence of
+// indented JSON events, one per request, response and final status, so that
+// traces of two runs can be compared with diff.
+package grpctrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// TopologyFile is the file of a trace directory that stores the reserved
+// topology.
+const TopologyFile = "topology.json"
+
+// Kinds of trace events.
+const (
+	KindSend   = "send"   // message sent by the client
+	KindRecv   = "recv"   // message received by the client
+	KindStatus = "status" // final status of the RPC
+)
+
+// Event is a single entry of a trace.
+type Event struct {
+	Time time.Time `json:"time"`
+	DUT  string    `json:"dut"`
+	// Call is the sequence number of the RPC within the trace.
+	Call   int    `json:"call"`
+	Method string `json:"method"`
+	Kind   string `json:"kind"`
+	// Type and Msg contain the protobuf message of send and recv events.
+	Type   string          `json:"type,omitempty"`
+	Msg    json.RawMessage `json:"msg,omitempty"`
+	Status *Status         `json:"status,omitempty"`
+}
+
+// Status is the final status of an RPC.
+type Status struct {
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+var (
+	testMu      sync.Mutex
+	currentTest string
+)
+
+// SetTest directs the traffic to the trace of the test until the test
+// completes.
+func SetTest(t testing.TB) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	currentTest = t.Name()
+	t.Cleanup(func() {
+		testMu.Lock()
+		defer testMu.Unlock()
+		if currentTest == t.Name() {
+			currentTest = ""
+		}
+	})
+}
+
+// traceName returns the name of the trace of the running test.
+func traceName() string {
+	testMu.Lock()
+	defer testMu.Unlock()
+	if currentTest == "" {
+		return "main"
+	}
+	return strings.ReplaceAll(currentTest, "/", "_")
+}
+
+func tracePath(dir, name string) string {
+	return filepath.Join(dir, name+".trace")
+}
+
+// marshalMsg returns the type name and the compact JSON of the message.
+func marshalMsg(m any) (string, json.RawMessage, error) {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return "", nil, fmt.Errorf("message %T is not a protobuf message", m)
+	}
+	js, err := protojson.Marshal(pm)
+	if err != nil {
+		return "", nil, err
+	}
+	// protojson output is deliberately unstable, normalize it.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, js); err != nil {
+		return "", nil, err
+	}
+	return string(proto.MessageName(pm)), buf.Bytes(), nil
+}
+
+// unmarshalMsg fills the message with the one of the event.
+func unmarshalMsg(e *Event, m any) error {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Errorf("message %T is not a protobuf message", m)
+	}
+	if want := string(proto.MessageName(pm)); e.Type != want {
+		return fmt.Errorf("recorded message of %s call %d is %s, want %s", e.Method, e.Call, e.Type, want)
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(e.Msg, pm)
+}
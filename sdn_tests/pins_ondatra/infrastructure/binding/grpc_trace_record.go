@@ -0,0 +1,188 @@
+package grpctrace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Recorder writes the gRPC traffic passing its interceptors to trace files.
+type Recorder struct {
+	dir string
+
+	mu     sync.Mutex
+	traces map[string]*traceFile
+	closed bool
+}
+
+type traceFile struct {
+	file  *os.File
+	enc   *json.Encoder
+	calls int
+}
+
+// NewRecorder creates a recorder writing to the given directory.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory %s: %v", dir, err)
+	}
+	return &Recorder{dir: dir, traces: map[string]*traceFile{}}, nil
+}
+
+// Dir returns the trace directory.
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// newCall returns the trace and the sequence number of a new RPC.
+func (r *Recorder) newCall() (string, int, error) {
+	name := traceName()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return "", 0, fmt.Errorf("recorder is closed")
+	}
+	t, ok := r.traces[name]
+	if !ok {
+		f, err := os.Create(tracePath(r.dir, name))
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to create trace %s: %v", name, err)
+		}
+		t = &traceFile{file: f, enc: json.NewEncoder(f)}
+		t.enc.SetIndent("", "  ")
+		r.traces[name] = t
+	}
+	t.calls++
+	return name, t.calls, nil
+}
+
+// call records the events of a single RPC.
+type call struct {
+	r      *Recorder
+	trace  string
+	dut    string
+	id     int
+	method string
+}
+
+func (r *Recorder) startCall(dut, method string) *call {
+	trace, id, err := r.newCall()
+	if err != nil {
+		log.Warningf("Not recording %s call to %s: %v", method, dut, err)
+		return nil
+	}
+	return &call{r: r, trace: trace, dut: dut, id: id, method: method}
+}
+
+func (c *call) write(e *Event) {
+	if c == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.DUT = c.dut
+	e.Call = c.id
+	e.Method = c.method
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	t, ok := c.r.traces[c.trace]
+	if !ok {
+		return
+	}
+	if err := t.enc.Encode(e); err != nil {
+		log.Warningf("Failed to record %s call %d: %v", c.method, c.id, err)
+	}
+}
+
+func (c *call) message(kind string, m any) {
+	if c == nil {
+		return
+	}
+	typ, js, err := marshalMsg(m)
+	if err != nil {
+		log.Warningf("Failed to record %s message of %s call %d: %v", kind, c.method, c.id, err)
+		return
+	}
+	c.write(&Event{Kind: kind, Type: typ, Msg: js})
+}
+
+func (c *call) status(err error) {
+	s := status.Convert(err)
+	c.write(&Event{Kind: KindStatus, Status: &Status{Code: s.Code(), Message: s.Message()}})
+}
+
+// UnaryInterceptor records the unary RPCs sent to the DUT.
+func (r *Recorder) UnaryInterceptor(dut string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		c := r.startCall(dut, method)
+		c.message(KindSend, req)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			c.message(KindRecv, reply)
+		}
+		c.status(err)
+		return err
+	}
+}
+
+// StreamInterceptor records the streaming RPCs sent to the DUT.
+func (r *Recorder) StreamInterceptor(dut string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		c := r.startCall(dut, method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			c.status(err)
+			return nil, err
+		}
+		return &recordedStream{ClientStream: cs, call: c}, nil
+	}
+}
+
+type recordedStream struct {
+	grpc.ClientStream
+	call *call
+	once sync.Once
+}
+
+func (s *recordedStream) SendMsg(m any) error {
+	s.call.message(KindSend, m)
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *recordedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.call.message(KindRecv, m)
+		return nil
+	}
+	s.once.Do(func() {
+		if err == io.EOF {
+			s.call.status(nil)
+		} else {
+			s.call.status(err)
+		}
+	})
+	return err
+}
+
+// Close closes all trace files.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	var err error
+	for name, t := range r.traces {
+		if e := t.file.Close(); e != nil && err == nil {
+			err = fmt.Errorf("failed to close trace %s: %v", name, e)
+		}
+		delete(r.traces, name)
+	}
+	return err
+}
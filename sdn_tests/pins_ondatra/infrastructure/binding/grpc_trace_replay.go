@@ -0,0 +1,224 @@
+package grpctrace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Player serves the RPCs passing its interceptors from trace files instead of
+// sending them. Every RPC is answered by the first unused recorded call with
+// the same DUT and method in the trace of the running test.
+type Player struct {
+	dir string
+
+	mu     sync.Mutex
+	traces map[string]*replayTrace
+}
+
+type replayTrace struct {
+	calls []*replayCall
+	used  map[*replayCall]bool
+}
+
+type replayCall struct {
+	dut, method string
+	sends       []*Event
+	recvs       []*Event
+	status      *Status
+}
+
+// NewPlayer creates a player serving the traces of the given directory.
+func NewPlayer(dir string) (*Player, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("invalid trace directory: %v", err)
+	}
+	return &Player{dir: dir, traces: map[string]*replayTrace{}}, nil
+}
+
+// loadTrace reads the events of the trace and groups them by call.
+func loadTrace(path string) (*replayTrace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &replayTrace{used: map[*replayCall]bool{}}
+	calls := map[int]*replayCall{}
+	dec := json.NewDecoder(f)
+	for {
+		e := &Event{}
+		if err := dec.Decode(e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse trace %s: %v", path, err)
+		}
+		c, ok := calls[e.Call]
+		if !ok {
+			c = &replayCall{dut: e.DUT, method: e.Method}
+			calls[e.Call] = c
+			t.calls = append(t.calls, c)
+		}
+		switch e.Kind {
+		case KindSend:
+			c.sends = append(c.sends, e)
+		case KindRecv:
+			c.recvs = append(c.recvs, e)
+		case KindStatus:
+			c.status = e.Status
+		}
+	}
+	return t, nil
+}
+
+// next returns the recorded call answering an RPC.
+func (p *Player) next(dut, method string) (*replayCall, error) {
+	name := traceName()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.traces[name]
+	if !ok {
+		var err error
+		if t, err = loadTrace(tracePath(p.dir, name)); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to load trace %s: %v", name, err)
+		}
+		p.traces[name] = t
+	}
+	for _, c := range t.calls {
+		if !t.used[c] && c.dut == dut && c.method == method {
+			t.used[c] = true
+			return c, nil
+		}
+	}
+	return nil, status.Errorf(codes.Internal, "trace %s has no more %s calls to %s", name, method, dut)
+}
+
+// checkSend logs when a sent message differs from the recording.
+func (c *replayCall) checkSend(i int, m any) {
+	if i >= len(c.sends) {
+		log.Warningf("Replayed %s call to %s sends more messages than recorded", c.method, c.dut)
+		return
+	}
+	_, got, err := marshalMsg(m)
+	if err != nil {
+		log.Warningf("Failed to compare replayed %s message: %v", c.method, err)
+		return
+	}
+	if want := c.sends[i].Msg; !bytes.Equal(got, want) {
+		log.Warningf("Replayed %s message to %s differs from recording:\ngot:  %s\nwant: %s", c.method, c.dut, got, want)
+	}
+}
+
+// err returns the recorded final status of the call.
+func (c *replayCall) err() error {
+	if c.status == nil || c.status.Code == codes.OK {
+		return nil
+	}
+	return status.Error(c.status.Code, c.status.Message)
+}
+
+// UnaryInterceptor answers unary RPCs sent to the DUT from the traces.
+func (p *Player) UnaryInterceptor(dut string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		c, err := p.next(dut, method)
+		if err != nil {
+			return err
+		}
+		c.checkSend(0, req)
+		if len(c.recvs) > 0 {
+			if err := unmarshalMsg(c.recvs[0], reply); err != nil {
+				return status.Errorf(codes.Internal, "failed to replay %s response: %v", method, err)
+			}
+		}
+		return c.err()
+	}
+}
+
+// StreamInterceptor answers streaming RPCs sent to the DUT from the traces.
+func (p *Player) StreamInterceptor(dut string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		c, err := p.next(dut, method)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.sends) == 0 && len(c.recvs) == 0 {
+			// The stream failed to start.
+			if err := c.err(); err != nil {
+				return nil, err
+			}
+		}
+		return &replayStream{ctx: ctx, call: c}, nil
+	}
+}
+
+// replayStream serves the messages of a recorded stream. Sent and received
+// messages are replayed independently of each other.
+type replayStream struct {
+	ctx  context.Context
+	call *replayCall
+
+	mu    sync.Mutex
+	sent  int
+	recvd int
+}
+
+func (s *replayStream) Header() (metadata.MD, error) {
+	return metadata.MD{}, nil
+}
+
+func (s *replayStream) Trailer() metadata.MD {
+	return nil
+}
+
+func (s *replayStream) CloseSend() error {
+	return nil
+}
+
+func (s *replayStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *replayStream) SendMsg(m any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.call.checkSend(s.sent, m)
+	s.sent++
+	return nil
+}
+
+// RecvMsg returns the next recorded message, followed by the recorded status.
+// Streams that were cancelled by the client block until the client cancels
+// them again.
+func (s *replayStream) RecvMsg(m any) error {
+	s.mu.Lock()
+	if s.recvd < len(s.call.recvs) {
+		e := s.call.recvs[s.recvd]
+		s.recvd++
+		s.mu.Unlock()
+		if err := unmarshalMsg(e, m); err != nil {
+			return status.Errorf(codes.Internal, "failed to replay %s response: %v", s.call.method, err)
+		}
+		return nil
+	}
+	s.mu.Unlock()
+
+	if st := s.call.status; st != nil && st.Code != codes.Canceled && st.Code != codes.DeadlineExceeded {
+		if err := s.call.err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	<-s.ctx.Done()
+	return status.FromContextError(s.ctx.Err()).Err()
+}
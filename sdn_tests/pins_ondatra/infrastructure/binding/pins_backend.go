@@ -3,10 +3,8 @@ package pinsbackend
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"os"
+	"sort"
 	"time"
 	"flag"
 
@@ -16,175 +14,279 @@ import (
 	opb "github.com/openconfig/ondatra/proto"
 	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+
+	inpb "github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/proto/inventory"
 )
 
 var (
-	supportedSecurityModes = []string{"insecure", "mtls"}
-	securityMode = flag.String("security_mode", "insecure", fmt.Sprintf("define the security mode of the conntections to gnmi server, choose from : %v. Uses insecure as default.", supportedSecurityModes))
+	supportedSecurityModes = []string{"insecure", "tls", "mtls"}
+	securityMode = flag.String("security_mode", "insecure", fmt.Sprintf("define the security mode of the conntections to gnmi server, choose from : %v. Uses insecure as default. tls only authenticates the server.", supportedSecurityModes))
+	inventoryFile = flag.String("inventory", "infrastructure/data/inventory.textproto", "path to the testbed inventory (textproto or YAML) describing the devices that can be reserved.")
  )
 
 // Backend can reserve Ondatra DUTs and provide clients to interact with the DUTs.
 type Backend struct {
-	configs map[string]*tls.Config
+	creds     CredentialProvider
+	dialOpts  map[string][]grpc.DialOption // credentials keyed by service address
+	inventory *inpb.Inventory
+	resvID    string
+	leases    *leases
 }
 
-// New creates a backend object.
-func New() *Backend {
-	return &Backend{configs: map[string]*tls.Config{}}
-}
+// Option are configurable inputs to the backend.
+type Option func(b *Backend)
 
-// registerGRPCTLS caches grpc TLS certificates for the given serverName.
-func (b *Backend) registerGRPCTLS(grpc *bindingbackend.GRPCServices, serverName string) error {
-	if serverName == "" {
-		return fmt.Errorf("serverName is empty")
+// WithCredentialProvider sets the provider of the credentials used to dial the
+// DUTs. By default the credentials are taken from the inventory according to
+// --security_mode.
+func WithCredentialProvider(p CredentialProvider) Option {
+	return func(b *Backend) {
+		b.creds = p
 	}
+}
 
-	// Load certificate of the CA who signed server's certificate.
-	pemServerCA, err := os.ReadFile("ondatra/certs/ca_crt.pem")
-	if err != nil {
-		return err
+// New creates a backend object. The inventory is loaded from the --inventory
+// flag when the topology is reserved.
+func New(opts ...Option) *Backend {
+	b := &Backend{dialOpts: map[string][]grpc.DialOption{}}
+	for _, opt := range opts {
+		opt(b)
 	}
+	return b
+}
+
+// NewWithInventory creates a backend object that reserves devices from the
+// given inventory.
+func NewWithInventory(inv *inpb.Inventory, opts ...Option) *Backend {
+	b := New(opts...)
+	b.inventory = inv
+	return b
+}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(pemServerCA) {
-		return fmt.Errorf("failed to add server CA's certificate")
+// loadInventory loads the inventory from the --inventory flag unless the
+// backend was created with one.
+func (b *Backend) loadInventory() error {
+	if b.inventory != nil {
+		return nil
 	}
-	// Load client's certificate and private key
-	clientCert, err := tls.LoadX509KeyPair("ondatra/certs/client_crt.pem", "ondatra/certs/client_key.pem")
+	inv, err := LoadInventory(*inventoryFile)
 	if err != nil {
 		return err
 	}
+	b.inventory = inv
+	return nil
+}
 
-	for _, service := range grpc.Addr {
-		b.configs[service] = &tls.Config{
-			Certificates: []tls.Certificate{clientCert},
-			RootCAs:      certPool,
-			ServerName:   serverName,
-			MinVersion:  tls.VersionTLS13,
+// registerTopology caches the credentials for all services of the DUTs and
+// ATEs of the topology. Connections are identified by address, so services sharing an
+// address use the credentials of the first of them in alphabetical order.
+func (b *Backend) registerTopology(r *bindingbackend.ReservedTopology) error {
+	if b.creds == nil {
+		creds, err := NewInventoryCredentials(*securityMode)
+		if err != nil {
+			return err
 		}
+		b.creds = creds
 	}
 
+	devices := map[string]*inpb.Device{}
+	for _, dev := range append(append([]*inpb.Device(nil), b.inventory.GetDuts()...), b.inventory.GetAtes()...) {
+		devices[dev.GetName()] = dev
+	}
+	type reserved struct {
+		*bindingbackend.Device
+		grpc bindingbackend.GRPCServices
+	}
+	var reservedDevs []reserved
+	for _, dut := range r.DUTs {
+		reservedDevs = append(reservedDevs, reserved{dut.Device, dut.GRPC})
+	}
+	for _, ate := range r.ATEs {
+		reservedDevs = append(reservedDevs, reserved{ate.Device, ate.GRPC})
+	}
+	for _, rd := range reservedDevs {
+		log.Infof("testbed %s: %s", rd.ID, rd.Name)
+		dev, ok := devices[rd.Name]
+		if !ok {
+			return fmt.Errorf("reserved device %s is not in the inventory", rd.Name)
+		}
+		for _, service := range sortedServices(rd.grpc) {
+			addr := rd.grpc.Addr[service]
+			if _, ok := b.dialOpts[addr]; ok {
+				continue
+			}
+			tc, err := b.creds.TransportCredentials(dev, service)
+			if err != nil {
+				return fmt.Errorf("failed to get %s transport credentials of %s: %v", service, rd.Name, err)
+			}
+			opts := []grpc.DialOption{grpc.WithTransportCredentials(tc)}
+			rc, err := b.creds.PerRPCCredentials(dev, service)
+			if err != nil {
+				return fmt.Errorf("failed to get %s per-RPC credentials of %s: %v", service, rd.Name, err)
+			}
+			if rc != nil {
+				opts = append(opts, grpc.WithPerRPCCredentials(rc))
+			}
+			b.dialOpts[addr] = opts
+		}
+	}
 	return nil
 }
 
+// sortedServices returns the services in a stable order.
+func sortedServices(services bindingbackend.GRPCServices) []bindingbackend.GRPCService {
+	var sorted []bindingbackend.GRPCService
+	for service := range services.Addr {
+		sorted = append(sorted, service)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// freeInventory returns the inventory without the devices leased by other
+// reservations.
+func (b *Backend) freeInventory(id string) *inpb.Inventory {
+	inv := proto.Clone(b.inventory).(*inpb.Inventory)
+	inv.Duts, inv.Ates = nil, nil
+	for _, dev := range b.inventory.GetDuts() {
+		if !isLeased(dev.GetName(), id) {
+			inv.Duts = append(inv.Duts, dev)
+		}
+	}
+	for _, dev := range b.inventory.GetAtes() {
+		if !isLeased(dev.GetName(), id) {
+			inv.Ates = append(inv.Ates, dev)
+		}
+	}
+	return inv
+}
+
+func deviceNames(r *bindingbackend.ReservedTopology) []string {
+	var names []string
+	for _, dev := range reservedDevices(r) {
+		names = append(names, dev.Name)
+	}
+	return names
+}
 
 // ReserveTopology returns topology containing reserved DUT and ATE devices.
-func (b *Backend) ReserveTopology(ctx context.Context, tb *opb.Testbed, runtime, waitTime time.Duration) (*bindingbackend.ReservedTopology, error) {
-	// Fill in the Dut and Control device details.
-	dut := "192.168.0.1"     // sample dut address.
-	control := "192.168.0.2" // sample control address.
-	log.Infof("testbed Dut:%s Control switch:%s", dut, control)
-
-	grpcPort := "9339"
-	p4rtPort := "9559"
-	dutGRPCAddr := fmt.Sprintf("%v:%v", dut, grpcPort)
-	dutP4RTAddr := fmt.Sprintf("%v:%v", dut, p4rtPort)
-	controlGRPCAddr := fmt.Sprintf("%v:%v", control, grpcPort)
-	controlP4RTAddr := fmt.Sprintf("%v:%v", control, p4rtPort)
-
-	// Modify the reservation based on your topology.
-	r := &bindingbackend.ReservedTopology{
-		ID: "PINS Reservation",
-		DUTs: []*bindingbackend.DUTDevice{{
-			Device: &bindingbackend.Device{
-				ID:   "DUT",
-				Name: dut,
-				PortMap: map[string]*binding.Port{
-					"port1":  {Name: "Ethernet1/1/1"},
-					"port2":  {Name: "Ethernet1/1/5"},
-					"port3":  {Name: "Ethernet1/2/1"},
-					"port4":  {Name: "Ethernet1/2/5"},
-					"port5":  {Name: "Ethernet1/3/1"},
-					"port6":  {Name: "Ethernet1/3/5"},
-					"port7":  {Name: "Ethernet1/4/1"},
-					"port8":  {Name: "Ethernet1/4/5"},
-					"port9":  {Name: "Ethernet1/5/1"},
-					"port10": {Name: "Ethernet1/5/5"},
-					"port11": {Name: "Ethernet1/6/1"},
-					"port12": {Name: "Ethernet1/6/5"},
-					"port13": {Name: "Ethernet1/7/1"},
-					"port14": {Name: "Ethernet1/7/5"},
-					"port15": {Name: "Ethernet1/8/1"},
-					"port16": {Name: "Ethernet1/8/5"},
-					"port17": {Name: "Ethernet1/9/1"},
-					"port18": {Name: "Ethernet1/9/5"},
-					"port19": {Name: "Ethernet1/10/1"},
-					"port20": {Name: "Ethernet1/10/5"},
-				},
-			},
-			GRPC: bindingbackend.GRPCServices{
-				Addr: map[bindingbackend.GRPCService]string{
-					bindingbackend.GNMI: dutGRPCAddr,
-					bindingbackend.GNOI: dutGRPCAddr,
-					bindingbackend.GNSI: dutGRPCAddr,
-					bindingbackend.P4RT: dutP4RTAddr,
-				},
-			}},
-			{
-				Device: &bindingbackend.Device{
-					ID:   "CONTROL",
-					Name: control,
-					PortMap: map[string]*binding.Port{
-						"port1":  {Name: "Ethernet1/1/1"},
-						"port2":  {Name: "Ethernet1/1/5"},
-						"port3":  {Name: "Ethernet1/2/1"},
-						"port4":  {Name: "Ethernet1/2/5"},
-						"port5":  {Name: "Ethernet1/3/1"},
-						"port6":  {Name: "Ethernet1/3/5"},
-						"port7":  {Name: "Ethernet1/4/1"},
-						"port8":  {Name: "Ethernet1/4/5"},
-						"port9":  {Name: "Ethernet1/5/1"},
-						"port10": {Name: "Ethernet1/5/5"},
-						"port11": {Name: "Ethernet1/6/1"},
-						"port12": {Name: "Ethernet1/6/5"},
-						"port13": {Name: "Ethernet1/7/1"},
-						"port14": {Name: "Ethernet1/7/5"},
-						"port15": {Name: "Ethernet1/8/1"},
-						"port16": {Name: "Ethernet1/8/5"},
-						"port17": {Name: "Ethernet1/9/1"},
-						"port18": {Name: "Ethernet1/9/5"},
-						"port19": {Name: "Ethernet1/10/1"},
-						"port20": {Name: "Ethernet1/10/5"},
-					},
-				},
-				GRPC: bindingbackend.GRPCServices{
-					Addr: map[bindingbackend.GRPCService]string{
-						bindingbackend.GNMI: controlGRPCAddr,
-						bindingbackend.GNOI: controlGRPCAddr,
-						bindingbackend.GNSI: controlGRPCAddr,
-						bindingbackend.P4RT: controlP4RTAddr,
-					},
-				}},
-		}}
+// The partial mapping pins testbed DUTs and ports to specific inventory
+// devices and ports, the rest of the testbed is matched automatically.
+// The devices are leased exclusively, waiting up to waitTime for busy devices,
+// and the leases are renewed until runtime is over.
+func (b *Backend) ReserveTopology(ctx context.Context, tb *opb.Testbed, runtime, waitTime time.Duration, partial map[string]string) (*bindingbackend.ReservedTopology, error) {
+	if err := b.loadInventory(); err != nil {
+		return nil, err
+	}
 
-	for _, dut := range r.DUTs {
-		if err := b.registerGRPCTLS(&dut.GRPC, dut.Name); err != nil {
-			return nil, err
+	id := newReservationID()
+	var deadline time.Time
+	if runtime > 0 {
+		deadline = time.Now().Add(runtime)
+	}
+	var r *bindingbackend.ReservedTopology
+	err := waitForLeases(ctx, waitTime, func() error {
+		var err error
+		if r, err = matchTestbed(b.freeInventory(id), tb, partial); err != nil {
+			// Every match contains a leased device, lease one of them to
+			// report the busy devices.
+			if r, err = matchTestbed(b.inventory, tb, partial); err != nil {
+				return err
+			}
 		}
+		b.leases, err = acquireLeases(id, deviceNames(r), deadline)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.ID = id
+	if r.Links, err = topologyLinks(b.inventory, tb, r); err != nil {
+		b.releaseLeases()
+		return nil, err
+	}
+	if err := b.registerTopology(r); err != nil {
+		b.releaseLeases()
+		return nil, err
 	}
+	if err := saveTopology(r); err != nil {
+		b.releaseLeases()
+		return nil, err
+	}
+	log.Infof("Reserved topology %s, fetch it with --reserve=%s", r.ID, r.ID)
 
+	b.resvID = r.ID
 	return r, nil
 }
 
-// Release releases the reserved devices, called during teardown.
+// FetchTopology returns the topology of an existing reservation and takes
+// over its leases.
+func (b *Backend) FetchTopology(ctx context.Context, id string) (*bindingbackend.ReservedTopology, error) {
+	if err := b.loadInventory(); err != nil {
+		return nil, err
+	}
+
+	r, err := loadTopology(id)
+	if err != nil {
+		return nil, err
+	}
+	names := deviceNames(r)
+	if b.leases, err = acquireLeases(id, names, leaseDeadline(id, names)); err != nil {
+		return nil, fmt.Errorf("failed to lease devices of reservation %s: %v", id, err)
+	}
+	if err := b.registerTopology(r); err != nil {
+		b.releaseLeases()
+		return nil, err
+	}
+
+	b.resvID = r.ID
+	return r, nil
+}
+
+// releaseLeases frees the leased devices.
+func (b *Backend) releaseLeases() error {
+	if b.leases == nil {
+		return nil
+	}
+	err := b.leases.release()
+	b.leases = nil
+	return err
+}
+
+// Release releases the reserved devices, called during teardown. The
+// reservation state is kept with --keep_reservation so that other test
+// binaries can fetch it; its leases are no longer renewed and must be taken
+// over within --lease_ttl.
 func (b *Backend) Release(ctx context.Context) error {
+	if b.resvID == "" {
+		return nil
+	}
+	if *keepReservation {
+		if b.leases != nil {
+			b.leases.stopRenewal()
+			b.leases = nil
+		}
+		return nil
+	}
+	if err := b.releaseLeases(); err != nil {
+		return err
+	}
+	if err := removeTopology(b.resvID); err != nil {
+		return err
+	}
+	b.resvID = ""
 	return nil
 }
 
 // DialGRPC connects to grpc service and returns the opened grpc client for use.
 func (b *Backend) DialGRPC(ctx context.Context, addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
-	if *securityMode  == "mtls" {
-	    tlsConfig, ok := b.configs[addr]
-	    if !ok {
-	   	return nil, fmt.Errorf("failed to find TLS config for %s", addr)
-	    }
-
-	    opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
-        } else  {
-	   opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
- 	}
+	credOpts, ok := b.dialOpts[addr]
+	if !ok {
+		return nil, fmt.Errorf("failed to find credentials for %s", addr)
+	}
+	opts = append(opts, credOpts...)
 	conn, err := grpc.DialContext(ctx, addr, opts...)
  	if err != nil {
  		return nil, fmt.Errorf("DialContext(%s, %v) : %v", addr, opts, err)
@@ -192,11 +294,6 @@ func (b *Backend) DialGRPC(ctx context.Context, addr string, opts ...grpc.DialOp
 	return conn, nil
 }
 
-// DialConsole returns a StreamClient for the DUT.
-func (b *Backend) DialConsole(ctx context.Context, dut *binding.AbstractDUT) (binding.ConsoleClient, error) {
-	return nil, fmt.Errorf("unimplemented function")
-}
-
 // GNMIClient wraps the grpc connection under gnmi client.
 func (b *Backend) GNMIClient(ctx context.Context, dut *binding.AbstractDUT, conn *grpc.ClientConn) (gpb.GNMIClient, error) {
 	if conn == nil {
@@ -210,6 +307,6 @@ func (b *Backend) GNMIClient(ctx context.Context, dut *binding.AbstractDUT, conn
 
 // Close closes backend's internal objects.
 func (b *Backend) Close() error {
-	b.configs = nil
-	return nil
+	b.dialOpts = map[string][]grpc.DialOption{}
+	return b.releaseLeases()
 }
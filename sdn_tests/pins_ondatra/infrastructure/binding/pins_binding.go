@@ -3,25 +3,34 @@ package pinsbind
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	log "github.com/golang/glog"
 
+	"github.com/open-traffic-generator/snappi/gosnappi"
 	"github.com/openconfig/gnoigo"
 	"github.com/openconfig/ondatra/binding"
 	"github.com/openconfig/ondatra/binding/grpcutil"
 	pinsbackend "github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/pinsbackend"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 
 	opb "github.com/openconfig/ondatra/proto"
 	"github.com/openconfig/ondatra/proxy"
 	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
 
 	gpb "github.com/openconfig/gnmi/proto/gnmi"
 
+	acctzpb "github.com/openconfig/gnsi/acctz"
+	authzpb "github.com/openconfig/gnsi/authz"
+	certzpb "github.com/openconfig/gnsi/certz"
+	credzpb "github.com/openconfig/gnsi/credentialz"
+	pathzpb "github.com/openconfig/gnsi/pathz"
+	grpb "github.com/openconfig/gribi/proto/service"
 	rpb "github.com/openconfig/ondatra/proxy/proto/reservation"
 	p4pb "github.com/p4lang/p4runtime/go/p4/v1"
 )
@@ -38,7 +47,11 @@ var backend bindingbackend.Backend
 // Binding is a binding for PINS switches.
 type Binding struct {
 	resv       *binding.Reservation
+	links      []*bindingbackend.Link
 	httpDialer func(target string) (proxy.HTTPDoCloser, error)
+	// stopOutput stops parsing the test output, see
+	// testhelper.CaptureTestOutput.
+	stopOutput func()
 }
 
 // Option are configurable inputs to the binding.
@@ -78,6 +91,9 @@ func NewWithOpts(opts ...Option) (*Binding, error) {
 		opt(b)
 	}
 
+	if err := setupTrace(); err != nil {
+		return nil, err
+	}
 	if backend == nil {
 		backend = pinsbackend.New()
 	}
@@ -104,24 +120,41 @@ func (b *Binding) Reserve(ctx context.Context, tb *opb.Testbed, runtime, waitTim
 		return nil, fmt.Errorf("backend is not set")
 	}
 
-	if len(partial) > 0 {
-		return nil, fmt.Errorf("PINSBind Reserve does not yet support partial mappings")
-	}
-
-	reservedtopology, err := backend.ReserveTopology(ctx, tb, runtime, waitTime)
+	reservedtopology, err := backend.ReserveTopology(ctx, tb, runtime, waitTime, partial)
 	if err != nil {
 		return nil, fmt.Errorf("failed to reserve topology: %v", err)
 	}
+	if err := recordTopology(reservedtopology); err != nil {
+		log.Warning(err)
+	}
+	// The tests run once the reservation is made, so their output is parsed
+	// for the logs of the failed tests from now on.
+	if b.stopOutput, err = testhelper.CaptureTestOutput(); err != nil {
+		log.Warningf("Test results will not contain the logs of the failed tests: %v", err)
+	}
+
+	b.resv = b.reservation(reservedtopology)
+	return b.resv, nil
+}
 
+// reservation converts the reserved topology into an Ondatra reservation.
+func (b *Binding) reservation(reservedtopology *bindingbackend.ReservedTopology) *binding.Reservation {
 	resv := &binding.Reservation{ID: reservedtopology.ID, DUTs: map[string]binding.DUT{}}
+	b.links = reservedtopology.Links
 	for _, dut := range reservedtopology.DUTs {
 		resv.DUTs[dut.ID] = &pinsDUT{
 			AbstractDUT: &binding.AbstractDUT{&binding.Dims{
-				Name:  dut.Name,
-				Ports: dut.PortMap,
+				Name:            dut.Name,
+				Vendor:          dut.Vendor,
+				HardwareModel:   dut.HardwareModel,
+				SoftwareVersion: dut.SoftwareVersion,
+				Ports:           dut.PortMap,
 			}},
-			bind: b,
-			grpc: dut.GRPC,
+			id:        dut.ID,
+			bind:      b,
+			grpc:      dut.GRPC,
+			noSSH:     dut.NoSSH,
+			noHealthz: dut.NoHealthz,
 		}
 	}
 
@@ -131,32 +164,93 @@ func (b *Binding) Reserve(ctx context.Context, tb *opb.Testbed, runtime, waitTim
 	for _, ate := range reservedtopology.ATEs {
 		resv.ATEs[ate.ID] = &pinsATE{
 			AbstractATE: &binding.AbstractATE{&binding.Dims{
-				Name:  ate.Name,
-				Ports: ate.PortMap,
+				Name:            ate.Name,
+				Vendor:          ate.Vendor,
+				HardwareModel:   ate.HardwareModel,
+				SoftwareVersion: ate.SoftwareVersion,
+				Ports:           ate.PortMap,
 			}},
+			bind: b,
 			http: ate.HTTP,
+			grpc: ate.GRPC,
 		}
 	}
-
-	b.resv = resv
-	return resv, nil
+	return resv
 }
 
-// Release returns the testbed to a pool of resources.
+// Release cancels the open gNMI subscriptions, closes the shared connections
+// to the DUTs and ATEs and returns the testbed to a pool of resources.
 func (b *Binding) Release(ctx context.Context) error {
+	closeSubscriptions()
+	if b.resv != nil {
+		for _, dut := range b.resv.DUTs {
+			if err := dut.(*pinsDUT).closeConns(); err != nil {
+				log.Warning(err)
+			}
+		}
+		for _, ate := range b.resv.ATEs {
+			if err := ate.(*pinsATE).closeConns(); err != nil {
+				log.Warning(err)
+			}
+		}
+		for k, c := range ConnectionCounts() {
+			log.Infof("gRPC connections of %s: %+v", k, c)
+		}
+	}
+	if err := closeTrace(); err != nil {
+		log.Warning(err)
+	}
+	if b.stopOutput != nil {
+		b.stopOutput()
+	}
 	return backend.Release(ctx)
 }
 
 type pinsDUT struct {
 	*binding.AbstractDUT
-	bind *Binding
-	grpc bindingbackend.GRPCServices
+	id        string // testbed ID
+	bind      *Binding
+	grpc      bindingbackend.GRPCServices
+	conns     sharedConns
+	noSSH     bool
+	noHealthz bool
 }
 
 type pinsATE struct {
 	*binding.AbstractATE
-	bind *Binding
-	http bindingbackend.HTTPService
+	bind  *Binding
+	http  bindingbackend.HTTPService
+	grpc  bindingbackend.GRPCServices
+	conns sharedConns
+}
+
+// HasSSH returns whether the DUT can be reached over SSH.
+func (d *pinsDUT) HasSSH() bool {
+	return !d.noSSH
+}
+
+// HasHealthz returns whether the DUT serves gNOI Healthz.
+func (d *pinsDUT) HasHealthz() bool {
+	return !d.noHealthz
+}
+
+// HasLinks returns whether the reserved topology describes its cabling.
+func (d *pinsDUT) HasLinks() bool {
+	return len(d.bind.links) > 0
+}
+
+// PeerPort returns the testbed IDs of the device and port cabled to the port
+// of the DUT with the given testbed ID.
+func (d *pinsDUT) PeerPort(portID string) (string, string, bool) {
+	for _, l := range d.bind.links {
+		switch {
+		case l.A.Device == d.id && l.A.Port == portID:
+			return l.B.Device, l.B.Port, true
+		case l.B.Device == d.id && l.B.Port == portID:
+			return l.A.Device, l.A.Port, true
+		}
+	}
+	return "", "", false
 }
 
 // DialGRPC will return a gRPC client conn for the target. This method should
@@ -177,20 +271,10 @@ func (b *Binding) HTTPClient(target string) (proxy.HTTPDoCloser, error) {
 
 // DialGNMI connects directly to the switch's proxy.
 func (d *pinsDUT) DialGNMI(ctx context.Context, opts ...grpc.DialOption) (gpb.GNMIClient, error) {
-	addr := d.grpc.Addr[bindingbackend.GNMI]
-	if addr == "" {
-		return nil, fmt.Errorf("service gnmi not registered on DUT %q", d.Name())
-	}
-
 	const defaultTimeout = time.Minute
 	ctx, cancel := grpcutil.WithDefaultTimeout(ctx, defaultTimeout)
 	defer cancel()
-	opts = append(opts,
-		grpcutil.WithUnaryDefaultTimeout(defaultTimeout),
-		grpcutil.WithStreamDefaultTimeout(defaultTimeout),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(1024*1024*20)))
-
-	conn, err := d.bind.DialGRPC(ctx, addr, opts...)
+	conn, err := d.dial(ctx, bindingbackend.GNMI, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -199,120 +283,95 @@ func (d *pinsDUT) DialGNMI(ctx context.Context, opts ...grpc.DialOption) (gpb.GN
 	if err != nil {
 		return nil, err
 	}
-	return &clientWrap{GNMIClient: cli}, nil
+	chain, err := gnmiChain()
+	if err != nil {
+		return nil, err
+	}
+	return &clientWrap{GNMIClient: cli, dut: d.Name(), chain: chain}, nil
 }
 
+// clientWrap runs the gNMI traffic with the DUT through the enabled gNMI
+// translators.
 type clientWrap struct {
 	gpb.GNMIClient
+	dut   string
+	chain []*registeredTranslator
 }
 
-// wrapValueInUpdate wraps the typed value in the provided update into a
-// serialized JSON node., e.g.
-// - 123 -> {"foo": 123}
-// - [{"str": "one"}] -> {"foo": [{"str": "one"}]}
-// - {"str": "test-string"} -> {"foo": {"str": "test-string"}}
-func wrapValueInUpdate(up *gpb.Update) error {
-	elems := up.GetPath().GetElem()
-	if len(elems) == 0 {
-		// root path case
-		return nil
-	}
-	name := elems[len(elems)-1].GetName()
-	var i any
-	if err := json.Unmarshal(up.GetVal().GetJsonIetfVal(), &i); err != nil {
-		return fmt.Errorf("unable to unmarshal config: %v", err)
-	}
-
-	// For list paths such as /interfaces/interface[name=<key>], JSON IETF value
-	// needs to be an array instead of an object. Ondatra returns value for such paths
-	// as an object, which need to be translated into a JSON array. E.g.
-	// - {"str": "test-string"} -> [{"str": "test-string"}]
-	if len(elems[len(elems)-1].GetKey()) > 0 {
-		// The path is a list node. Perform translation to JSON array.
-		var arr []any
-		arr = append(arr, i)
-		arrVal, err := json.Marshal(arr)
-		if err != nil {
-			return fmt.Errorf("unable to marshal value %v as a JSON array: %v", arr, err)
-		}
-		if err := json.Unmarshal(arrVal, &i); err != nil {
-			return fmt.Errorf("unable to unmarshal JSON array config: %v", err)
-		}
+func (c *clientWrap) Set(ctx context.Context, in *gpb.SetRequest, opts ...grpc.CallOption) (*gpb.SetResponse, error) {
+	in = proto.Clone(in).(*gpb.SetRequest)
+	if err := translateRequest(c.chain, func(t GNMITranslator) error { return t.SetRequest(in) }); err != nil {
+		return nil, err
 	}
-	js, err := json.MarshalIndent(map[string]any{name: i}, "", "  ")
+	resp, err := c.GNMIClient.Set(ctx, in, opts...)
 	if err != nil {
-		return fmt.Errorf("unable to marshal config with wrapping container: %v", err)
-	}
-	up.GetVal().Value = &gpb.TypedValue_JsonIetfVal{js}
-	return nil
-}
-
-func (c *clientWrap) Set(ctx context.Context, in *gpb.SetRequest, opts ...grpc.CallOption) (*gpb.SetResponse, error) {
-	for _, up := range in.GetReplace() {
-		if err := wrapValueInUpdate(up); err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
-	for _, up := range in.GetUpdate() {
-		if err := wrapValueInUpdate(up); err != nil {
-			return nil, err
-		}
+	if err := translateResponse(c.chain, func(t GNMITranslator) error { return t.SetResponse(resp) }); err != nil {
+		return nil, err
 	}
-
-	return c.GNMIClient.Set(ctx, in, opts...)
+	return resp, nil
 }
 
 func (c *clientWrap) Get(ctx context.Context, in *gpb.GetRequest, opts ...grpc.CallOption) (*gpb.GetResponse, error) {
-	return c.GNMIClient.Get(ctx, in, opts...)
-}
-
-type subscribeClientWrap struct {
-	gpb.GNMI_SubscribeClient
-	client *clientWrap
-}
-
-// CloseSend signals that the client has done sending messages to the server.
-// Calling the CloseSend will cause PINs to close the Subscribe stream and return an
-// error. Hence we overwrite this method to be no-op here.
-func (sc *subscribeClientWrap) CloseSend() error {
-	return nil
-}
-
-func (c *clientWrap) Subscribe(ctx context.Context, opts ...grpc.CallOption) (gpb.GNMI_SubscribeClient, error) {
-	sub, err := c.GNMIClient.Subscribe(ctx, opts...)
+	in = proto.Clone(in).(*gpb.GetRequest)
+	if err := translateRequest(c.chain, func(t GNMITranslator) error { return t.GetRequest(in) }); err != nil {
+		return nil, err
+	}
+	resp, err := c.GNMIClient.Get(ctx, in, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &subscribeClientWrap{GNMI_SubscribeClient: sub, client: c}, nil
+	if err := translateResponse(c.chain, func(t GNMITranslator) error { return t.GetResponse(resp) }); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 func (c *clientWrap) Capabilities(ctx context.Context, in *gpb.CapabilityRequest, opts ...grpc.CallOption) (*gpb.CapabilityResponse, error) {
-	return c.GNMIClient.Capabilities(ctx, in, opts...)
+	in = proto.Clone(in).(*gpb.CapabilityRequest)
+	if err := translateRequest(c.chain, func(t GNMITranslator) error { return t.CapabilityRequest(in) }); err != nil {
+		return nil, err
+	}
+	resp, err := c.GNMIClient.Capabilities(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := translateResponse(c.chain, func(t GNMITranslator) error { return t.CapabilityResponse(resp) }); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 // DialGNOI connects directly to the switch's proxy.
 func (d *pinsDUT) DialGNOI(ctx context.Context, opts ...grpc.DialOption) (gnoigo.Clients, error) {
-	addr := d.grpc.Addr[bindingbackend.GNOI]
-	if addr == "" {
-		return nil, fmt.Errorf("service gnoi not registered on DUT %q", d.Name())
+	conn, err := dialService(ctx, d, bindingbackend.GNOI, opts)
+	if err != nil {
+		return nil, err
 	}
+	return &GNOIClients{
+		Clients: gnoigo.NewClients(conn),
+	}, nil
+}
 
+// serviceDialer dials the shared gRPC connections of a DUT or an ATE.
+type serviceDialer interface {
+	Name() string
+	dial(ctx context.Context, service bindingbackend.GRPCService, opts ...grpc.DialOption) (*grpc.ClientConn, error)
+}
+
+// dialService dials the service of the device with the default dial timeout of
+// the binding. gNMI has its own default, see DialGNMI.
+func dialService(ctx context.Context, dev serviceDialer, service bindingbackend.GRPCService, opts []grpc.DialOption) (*grpc.ClientConn, error) {
 	ctx, cancel := grpcutil.WithDefaultTimeout(ctx, 2*time.Minute)
 	defer cancel()
-	opts = append(opts,
-		grpcutil.WithUnaryDefaultTimeout(30*time.Second),
-		grpcutil.WithStreamDefaultTimeout(2*time.Minute),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(1024*1024*20)))
-
-	conn, err := d.bind.DialGRPC(ctx, addr, opts...)
+	conn, err := dev.dial(ctx, service, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Infof("GNOI dial success Address:%s, Switch:%s", conn.Target(), d.Name())
-	return &GNOIClients{
-		Clients: gnoigo.NewClients(conn),
-	}, nil
+	log.Infof("%s dial success Address:%s, Device:%s", strings.ToUpper(string(service)), conn.Target(), dev.Name())
+	return conn, nil
 }
 
 // GNOIClients consist of the GNOI clients supported by PINs.
@@ -320,26 +379,61 @@ type GNOIClients struct {
 	gnoigo.Clients
 }
 
-// DialP4RT connects directly to the switch's proxy.
-func (d *pinsDUT) DialP4RT(ctx context.Context, opts ...grpc.DialOption) (p4pb.P4RuntimeClient, error) {
-	addr := d.grpc.Addr[bindingbackend.P4RT]
-	if addr == "" {
-		return nil, fmt.Errorf("service gnsi not registered on DUT %q", d.Name())
+// DialGNSI connects directly to the switch's proxy.
+func (d *pinsDUT) DialGNSI(ctx context.Context, opts ...grpc.DialOption) (binding.GNSIClients, error) {
+	conn, err := dialService(ctx, d, bindingbackend.GNSI, opts)
+	if err != nil {
+		return nil, err
 	}
+	return &GNSIClients{conn: conn}, nil
+}
 
-	ctx, cancel := grpcutil.WithDefaultTimeout(ctx, 2*time.Minute)
-	defer cancel()
-	opts = append(opts,
-		grpcutil.WithUnaryDefaultTimeout(30*time.Second),
-		grpcutil.WithStreamDefaultTimeout(2*time.Minute),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(1024*1024*20)))
+// GNSIClients consist of the GNSI clients supported by PINs.
+type GNSIClients struct {
+	*binding.AbstractGNSIClients
+	conn *grpc.ClientConn
+}
+
+// Authz returns the gNSI Authz client.
+func (c *GNSIClients) Authz() authzpb.AuthzClient {
+	return authzpb.NewAuthzClient(c.conn)
+}
+
+// Certz returns the gNSI Certz client.
+func (c *GNSIClients) Certz() certzpb.CertzClient {
+	return certzpb.NewCertzClient(c.conn)
+}
+
+// Credentialz returns the gNSI Credentialz client.
+func (c *GNSIClients) Credentialz() credzpb.CredentialzClient {
+	return credzpb.NewCredentialzClient(c.conn)
+}
+
+// Pathz returns the gNSI Pathz client.
+func (c *GNSIClients) Pathz() pathzpb.PathzClient {
+	return pathzpb.NewPathzClient(c.conn)
+}
+
+// Acctz returns the gNSI Acctz client.
+func (c *GNSIClients) Acctz() acctzpb.AcctzClient {
+	return acctzpb.NewAcctzClient(c.conn)
+}
 
-	conn, err := d.bind.DialGRPC(ctx, addr, opts...)
+// DialGRIBI connects directly to the switch's proxy.
+func (d *pinsDUT) DialGRIBI(ctx context.Context, opts ...grpc.DialOption) (grpb.GRIBIClient, error) {
+	conn, err := dialService(ctx, d, bindingbackend.GRIBI, opts)
 	if err != nil {
 		return nil, err
 	}
+	return grpb.NewGRIBIClient(conn), nil
+}
 
-	log.Infof("P4RT dial success Address:%s, Switch:%s", conn.Target(), d.Name())
+// DialP4RT connects directly to the switch's proxy.
+func (d *pinsDUT) DialP4RT(ctx context.Context, opts ...grpc.DialOption) (p4pb.P4RuntimeClient, error) {
+	conn, err := dialService(ctx, d, bindingbackend.P4RT, opts)
+	if err != nil {
+		return nil, err
+	}
 	return p4pb.NewP4RuntimeClient(conn), nil
 }
 
@@ -348,9 +442,26 @@ func (d *pinsDUT) DialConsole(ctx context.Context) (binding.ConsoleClient, error
 	return backend.DialConsole(ctx, d.AbstractDUT)
 }
 
-// FetchReservation unimplemented for experimental purposes.
-func (*Binding) FetchReservation(context.Context, string) (*binding.Reservation, error) {
-	return nil, nil
+// FetchReservation returns the existing reservation with the given ID.
+func (b *Binding) FetchReservation(ctx context.Context, id string) (*binding.Reservation, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("backend is not set")
+	}
+
+	reservedtopology, err := backend.FetchTopology(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reservation %s: %v", id, err)
+	}
+	if err := recordTopology(reservedtopology); err != nil {
+		log.Warning(err)
+	}
+	// As in Reserve, the tests run once the reservation is fetched.
+	if b.stopOutput, err = testhelper.CaptureTestOutput(); err != nil {
+		log.Warningf("Test results will not contain the logs of the failed tests: %v", err)
+	}
+
+	b.resv = b.reservation(reservedtopology)
+	return b.resv, nil
 }
 
 // Resolve will return a concrete reservation with services defined.
@@ -386,31 +497,64 @@ func resolvePort(k string, p *binding.Port) *rpb.ResolvedPort {
 	}
 }
 
+// grpcServiceIDs contains the fully qualified names of the gRPC services
+// served by each registered service address.
+var grpcServiceIDs = map[bindingbackend.GRPCService][]string{
+	bindingbackend.GNMI: {"gnmi.gNMI"},
+	bindingbackend.GNOI: {
+		"gnoi.bgp.BGP",
+		"gnoi.certificate.CertificateManagement",
+		"gnoi.diag.Diag",
+		"gnoi.factory_reset.FactoryReset",
+		"gnoi.file.File",
+		"gnoi.healthz.Healthz",
+		"gnoi.layer2.Layer2",
+		"gnoi.mpls.MPLS",
+		"gnoi.optical.OTDR",
+		"gnoi.optical.WavelengthRouter",
+		"gnoi.os.OS",
+		"gnoi.packet_link_qualification.LinkQualification",
+		"gnoi.system.System",
+	},
+	bindingbackend.GNSI: {
+		"gnsi.acctz.v1.Acctz",
+		"gnsi.authz.v1.Authz",
+		"gnsi.certz.v1.Certz",
+		"gnsi.credentialz.v1.Credentialz",
+		"gnsi.pathz.v1.Pathz",
+	},
+	bindingbackend.GRIBI: {"gribi.gRIBI"},
+	bindingbackend.P4RT:  {"p4.v1.P4Runtime"},
+	bindingbackend.OTG:   {"otg.Openapi"},
+}
+
+// resolveGRPC adds the gRPC services of a device to the resolved services.
+func resolveGRPC(services map[string]*rpb.Service, grpcServices bindingbackend.GRPCServices) {
+	for service, addr := range grpcServices.Addr {
+		if addr == "" {
+			continue
+		}
+		for _, id := range grpcServiceIDs[service] {
+			services[id] = &rpb.Service{
+				Id: id,
+				Endpoint: &rpb.Service_ProxiedGrpc{
+					ProxiedGrpc: &rpb.ProxiedGRPCEndpoint{
+						Address: addr,
+						Proxy:   grpcServices.Proxy[service],
+					},
+				},
+			}
+		}
+	}
+}
+
 func (b *Binding) resolveDUT(key string, d *pinsDUT) (*rpb.ResolvedDevice, error) {
 	ports := map[string]*rpb.ResolvedPort{}
 	for k, p := range d.Ports() {
 		ports[k] = resolvePort(k, p)
 	}
-	services := map[string]*rpb.Service{
-		"gnmi.gNMI": {
-			Id: "gnmi.gNMI",
-			Endpoint: &rpb.Service_ProxiedGrpc{
-				ProxiedGrpc: &rpb.ProxiedGRPCEndpoint{
-					Address: d.grpc.Addr[bindingbackend.GNMI],
-					Proxy:   nil,
-				},
-			},
-		},
-		"p4.v1.P4Runtime": {
-			Id: "p4.v1.P4Runtime",
-			Endpoint: &rpb.Service_ProxiedGrpc{
-				ProxiedGrpc: &rpb.ProxiedGRPCEndpoint{
-					Address: d.grpc.Addr[bindingbackend.P4RT],
-					Proxy:   nil,
-				},
-			},
-		},
-	}
+	services := map[string]*rpb.Service{}
+	resolveGRPC(services, d.grpc)
 	return &rpb.ResolvedDevice{
 		Id:              key,
 		HardwareModel:   d.HardwareModel(),
@@ -437,6 +581,7 @@ func (b *Binding) resolveATE(key string, d *pinsATE) (*rpb.ResolvedDevice, error
 			},
 		},
 	}
+	resolveGRPC(services, d.grpc)
 	return &rpb.ResolvedDevice{
 		Id:              key,
 		HardwareModel:   d.HardwareModel(),
@@ -447,3 +592,14 @@ func (b *Binding) resolveATE(key string, d *pinsATE) (*rpb.ResolvedDevice, error
 		Services:        services,
 	}, nil
 }
+
+// DialOTG connects directly to the OTG service of the traffic generator.
+func (a *pinsATE) DialOTG(ctx context.Context, opts ...grpc.DialOption) (gosnappi.Api, error) {
+	conn, err := dialService(ctx, a, bindingbackend.OTG, opts)
+	if err != nil {
+		return nil, err
+	}
+	api := gosnappi.NewApi()
+	api.NewGrpcTransport().SetClientConnection(conn)
+	return api, nil
+}
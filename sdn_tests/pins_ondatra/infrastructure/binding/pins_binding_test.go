@@ -0,0 +1,116 @@
+package pinsbind
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/open-traffic-generator/snappi/gosnappi"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/fakebackend"
+	"google.golang.org/grpc"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	opb "github.com/openconfig/ondatra/proto"
+)
+
+func TestDialOTG(t *testing.T) {
+	fake := fakebackend.New()
+	SetBackend(fake)
+	t.Cleanup(CloseBackend)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	b, err := NewWithOpts()
+	if err != nil {
+		t.Fatalf("NewWithOpts() failed: %v", err)
+	}
+	resv, err := b.Reserve(ctx, &opb.Testbed{
+		Duts:  []*opb.Device{{Id: "DUT", Ports: []*opb.Port{{Id: "port1"}}}},
+		Ates:  []*opb.Device{{Id: "ATE", Ports: []*opb.Port{{Id: "port1"}}}},
+		Links: []*opb.Link{{A: "DUT:port1", B: "ATE:port1"}},
+	}, time.Minute, 0, nil)
+	if err != nil {
+		t.Fatalf("Reserve() failed: %v", err)
+	}
+	defer func() {
+		if err := b.Release(ctx); err != nil {
+			t.Errorf("Release() failed: %v", err)
+		}
+	}()
+	ate, ok := resv.ATEs["ATE"]
+	if !ok {
+		t.Fatalf("Reservation %v has no ATE", resv)
+	}
+
+	api, err := ate.DialOTG(ctx)
+	if err != nil {
+		t.Fatalf("DialOTG() failed: %v", err)
+	}
+	config := gosnappi.NewConfig()
+	config.Ports().Add().SetName("port1").SetLocation(ate.Ports()["port1"].Name)
+	if _, err := api.SetConfig(config); err != nil {
+		t.Fatalf("SetConfig() failed: %v", err)
+	}
+
+	a, err := fake.ATE("ATE")
+	if err != nil {
+		t.Fatalf("ATE(ATE) failed: %v", err)
+	}
+	ports := a.Config().GetPorts()
+	if len(ports) != 1 || ports[0].GetName() != "port1" || ports[0].GetLocation() != "1/1" {
+		t.Errorf("Config of the fake ATE has ports %v, want port1 at 1/1", ports)
+	}
+}
+
+func TestConnectionCache(t *testing.T) {
+	SetBackend(fakebackend.New())
+	t.Cleanup(CloseBackend)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	b, err := NewWithOpts()
+	if err != nil {
+		t.Fatalf("NewWithOpts() failed: %v", err)
+	}
+	resv, err := b.Reserve(ctx, &opb.Testbed{Duts: []*opb.Device{{Id: "DUT"}}}, time.Minute, 0, nil)
+	if err != nil {
+		t.Fatalf("Reserve() failed: %v", err)
+	}
+	defer func() {
+		if err := b.Release(ctx); err != nil {
+			t.Errorf("Release() failed: %v", err)
+		}
+	}()
+	dut := resv.DUTs["DUT"]
+	key := dut.Name() + "/" + string(bindingbackend.GNMI)
+	before := ConnectionCounts()[key]
+
+	tests := []struct {
+		desc      string
+		opts      []grpc.DialOption
+		wantDials int
+	}{
+		{desc: "first client dials the shared connection", wantDials: 1},
+		{desc: "second client shares the connection", wantDials: 1},
+		{desc: "client with its own options", opts: []grpc.DialOption{grpc.WithBlock()}, wantDials: 2},
+		{desc: "client with its own options again", opts: []grpc.DialOption{grpc.WithBlock()}, wantDials: 3},
+		{desc: "client without options after custom ones", wantDials: 3},
+	}
+	for _, tt := range tests {
+		c, err := dut.DialGNMI(ctx, tt.opts...)
+		if err != nil {
+			t.Fatalf("%s: DialGNMI() failed: %v", tt.desc, err)
+		}
+		if _, err := c.Capabilities(ctx, &gpb.CapabilityRequest{}); err != nil {
+			t.Errorf("%s: Capabilities() failed: %v", tt.desc, err)
+		}
+		got := ConnectionCounts()[key]
+		if dials := got.Dials - before.Dials; dials != tt.wantDials {
+			t.Errorf("%s: %d dials, want %d", tt.desc, dials, tt.wantDials)
+		}
+		if open := got.Open - before.Open; open != 1 {
+			t.Errorf("%s: %d shared connections open, want 1", tt.desc, open)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package pinsbind
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra/binding/grpcutil"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+)
+
+var (
+	connCache      = flag.Bool("grpc_conn_cache", true, "share one gRPC connection per DUT service between all clients instead of dialing a new connection for every client.")
+	dialAttempts   = flag.Int("grpc_dial_attempts", 5, "number of attempts to dial a gRPC service, e.g. while the switch reboots; 1 disables retries.")
+	dialTimeout    = flag.Duration("grpc_dial_timeout", 20*time.Second, "time a gRPC dial attempt waits for the service to accept the connection.")
+	dialBackoff    = flag.Duration("grpc_dial_backoff", time.Second, "delay before retrying a failed gRPC dial, doubled after every failed attempt up to --grpc_dial_max_backoff.")
+	dialMaxBackoff = flag.Duration("grpc_dial_max_backoff", 30*time.Second, "maximum delay between two attempts to dial a gRPC service.")
+)
+
+// connectParams reconnects quickly once a rebooted switch is back.
+var connectParams = grpc.ConnectParams{
+	Backoff: backoff.Config{
+		BaseDelay:  time.Second,
+		Multiplier: 1.6,
+		Jitter:     0.2,
+		MaxDelay:   10 * time.Second,
+	},
+	MinConnectTimeout: 20 * time.Second,
+}
+
+// ConnCount contains the connection counters of a device service.
+type ConnCount struct {
+	Dials      int // connections dialed
+	Open       int // shared connections currently open
+	Reconnects int // shared connections connected again, e.g. after a reboot
+}
+
+var (
+	connCountsMu sync.Mutex
+	connCounts   = map[string]*ConnCount{}
+)
+
+// ConnectionCounts returns the connection counters of all device services
+// keyed by "<device name>/<service>".
+func ConnectionCounts() map[string]ConnCount {
+	connCountsMu.Lock()
+	defer connCountsMu.Unlock()
+	counts := map[string]ConnCount{}
+	for k, c := range connCounts {
+		counts[k] = *c
+	}
+	return counts
+}
+
+func countConn(dut string, service bindingbackend.GRPCService, f func(c *ConnCount)) {
+	connCountsMu.Lock()
+	defer connCountsMu.Unlock()
+	key := dut + "/" + string(service)
+	if connCounts[key] == nil {
+		connCounts[key] = &ConnCount{}
+	}
+	f(connCounts[key])
+}
+
+// defaultDialOpts returns the default timeouts and call options of the
+// connections to the service.
+func defaultDialOpts(service bindingbackend.GRPCService) []grpc.DialOption {
+	unaryTimeout, streamTimeout := 30*time.Second, 2*time.Minute
+	if service == bindingbackend.GNMI {
+		unaryTimeout, streamTimeout = time.Minute, time.Minute
+	}
+	return []grpc.DialOption{
+		grpcutil.WithUnaryDefaultTimeout(unaryTimeout),
+		grpcutil.WithStreamDefaultTimeout(streamTimeout),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(1024 * 1024 * 20)),
+	}
+}
+
+// sharedConns holds the shared connection of every service of a device.
+type sharedConns struct {
+	mu    sync.Mutex
+	conns map[bindingbackend.GRPCService]*grpc.ClientConn
+	// dialing holds the services being dialed, their channel is closed once
+	// the dial completed.
+	dialing map[bindingbackend.GRPCService]chan struct{}
+	// own holds the connections dialed for a single client, they are closed
+	// with the shared ones.
+	own []*grpc.ClientConn
+}
+
+// dial returns the shared connection to the service of the DUT and dials it if
+// needed. The shared connection uses the default dial options of the service,
+// clients passing their own options get a connection of their own instead.
+// Failed connections are retried immediately, e.g. after a reboot, and
+// connections closed by a client are dialed again.
+func (d *pinsDUT) dial(ctx context.Context, service bindingbackend.GRPCService, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return d.conns.dial(ctx, d.bind, d.Name(), d.grpc, service, opts...)
+}
+
+// dial returns the shared connection to the service of the ATE, see
+// pinsDUT.dial.
+func (a *pinsATE) dial(ctx context.Context, service bindingbackend.GRPCService, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return a.conns.dial(ctx, a.bind, a.Name(), a.grpc, service, opts...)
+}
+
+// closeConns closes the shared connections of the DUT.
+func (d *pinsDUT) closeConns() error {
+	return d.conns.close(d.Name())
+}
+
+// closeConns closes the shared connections of the ATE.
+func (a *pinsATE) closeConns() error {
+	return a.conns.close(a.Name())
+}
+
+func (sc *sharedConns) dial(ctx context.Context, b *Binding, name string, services bindingbackend.GRPCServices, service bindingbackend.GRPCService, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	addr := services.Addr[service]
+	if addr == "" {
+		return nil, fmt.Errorf("service %s not registered on device %q", service, name)
+	}
+	own := len(opts) > 0 || !*connCache
+	opts = append(defaultDialOpts(service), opts...)
+	opts = append(opts, traceOpts(name)...)
+	opts = append(opts, metricsOpts(name)...)
+	if own {
+		conn, err := dialWithRetry(ctx, b, name, service, addr, opts...)
+		if err != nil {
+			return nil, err
+		}
+		sc.mu.Lock()
+		sc.own = append(sc.own, conn)
+		sc.mu.Unlock()
+		countConn(name, service, func(c *ConnCount) { c.Dials++ })
+		return conn, nil
+	}
+
+	// A single caller dials the service, the others wait for its connection
+	// without holding the lock.
+	sc.mu.Lock()
+	for {
+		if conn, ok := sc.cached(name, service); ok {
+			sc.mu.Unlock()
+			return conn, nil
+		}
+		wait, ok := sc.dialing[service]
+		if !ok {
+			break
+		}
+		sc.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for the dial of %s of %s: %v", service, name, ctx.Err())
+		case <-wait:
+		}
+		sc.mu.Lock()
+	}
+	if sc.dialing == nil {
+		sc.dialing = map[bindingbackend.GRPCService]chan struct{}{}
+	}
+	done := make(chan struct{})
+	sc.dialing[service] = done
+	sc.mu.Unlock()
+
+	opts = append(opts, grpc.WithConnectParams(connectParams))
+	conn, err := dialWithRetry(ctx, b, name, service, addr, opts...)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.dialing, service)
+	close(done)
+	if err != nil {
+		return nil, err
+	}
+	if sc.conns == nil {
+		sc.conns = map[bindingbackend.GRPCService]*grpc.ClientConn{}
+	}
+	sc.conns[service] = conn
+	countConn(name, service, func(c *ConnCount) {
+		c.Dials++
+		c.Open++
+	})
+	go countReconnects(conn, name, service)
+	return conn, nil
+}
+
+// countReconnects counts every time the shared connection is ready again
+// after it was first connected, until the connection is closed.
+func countReconnects(conn *grpc.ClientConn, name string, service bindingbackend.GRPCService) {
+	ready := false
+	for state := conn.GetState(); state != connectivity.Shutdown; state = conn.GetState() {
+		if state == connectivity.Ready {
+			if ready {
+				countConn(name, service, func(c *ConnCount) { c.Reconnects++ })
+			}
+			ready = true
+		}
+		conn.WaitForStateChange(context.Background(), state)
+	}
+}
+
+// cached returns the shared connection to the service if it is still usable.
+// Failed connections are reconnected immediately. It must be called with
+// sc.mu held.
+func (sc *sharedConns) cached(name string, service bindingbackend.GRPCService) (*grpc.ClientConn, bool) {
+	conn, ok := sc.conns[service]
+	if !ok {
+		return nil, false
+	}
+	switch conn.GetState() {
+	case connectivity.Shutdown:
+		delete(sc.conns, service)
+		countConn(name, service, func(c *ConnCount) { c.Open-- })
+		return nil, false
+	case connectivity.TransientFailure:
+		conn.ResetConnectBackoff()
+	}
+	return conn, true
+}
+
+// retryDelay returns the delay before the given retry of a dial, starting at
+// 1. The delay grows exponentially with a 20% jitter.
+func retryDelay(retry int) time.Duration {
+	delay := *dialBackoff
+	for i := 1; i < retry && delay < *dialMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > *dialMaxBackoff {
+		delay = *dialMaxBackoff
+	}
+	return time.Duration(float64(delay) * (0.8 + 0.4*rand.Float64()))
+}
+
+// dialWithRetry dials the service until it succeeds, --grpc_dial_attempts
+// attempts failed or the context is done. Every attempt waits up to
+// --grpc_dial_timeout for the connection to be ready.
+func dialWithRetry(ctx context.Context, b *Binding, name string, service bindingbackend.GRPCService, addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts, grpc.WithBlock())
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, *dialTimeout)
+		conn, err := b.DialGRPC(attemptCtx, addr, opts...)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("stopped dialing %s of %s: %v: %v", service, name, ctx.Err(), err)
+		}
+		if attempt >= *dialAttempts {
+			return nil, fmt.Errorf("failed to dial %s of %s after %d attempts: %v", service, name, attempt, err)
+		}
+		delay := retryDelay(attempt)
+		log.Warningf("Failed to dial %s of %s (attempt %d of %d), retrying in %v: %v", service, name, attempt, *dialAttempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped dialing %s of %s: %v: %v", service, name, ctx.Err(), err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (sc *sharedConns) close(name string) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var err error
+	for service, conn := range sc.conns {
+		if e := conn.Close(); e != nil && err == nil {
+			err = fmt.Errorf("failed to close %s connection of %s: %v", service, name, e)
+		}
+		delete(sc.conns, service)
+		countConn(name, service, func(c *ConnCount) { c.Open-- })
+	}
+	for _, conn := range sc.own {
+		if e := conn.Close(); e != nil && err == nil {
+			err = fmt.Errorf("failed to close connection of %s: %v", name, e)
+		}
+	}
+	sc.own = nil
+	return err
+}
@@ -0,0 +1,294 @@
+package pinsbackend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openconfig/ondatra/binding"
+	"golang.org/x/crypto/ssh"
+
+	inpb "github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/proto/inventory"
+)
+
+const consoleDialTimeout = 30 * time.Second
+
+// Telnet commands and options, see RFC 854, RFC 857 and RFC 858.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho = 1
+	telnetOptSGA  = 3
+)
+
+// telnetState is the state of the telnet stream parser.
+type telnetState int
+
+const (
+	telnetData telnetState = iota
+	telnetCommand
+	telnetOption
+	telnetSubnegotiation
+	telnetSubnegotiationIAC
+)
+
+// DialConsole connects to the serial console of the DUT through the terminal
+// server configured in the inventory.
+func (b *Backend) DialConsole(ctx context.Context, dut *binding.AbstractDUT) (binding.ConsoleClient, error) {
+	if err := b.loadInventory(); err != nil {
+		return nil, err
+	}
+
+	var console *inpb.Console
+	for _, dev := range b.inventory.GetDuts() {
+		if dev.GetName() == dut.Name() {
+			console = dev.GetConsole()
+			break
+		}
+	}
+	if console.GetAddress() == "" {
+		return nil, fmt.Errorf("no console configured for %s in the inventory", dut.Name())
+	}
+
+	switch console.GetProtocol() {
+	case inpb.Console_SSH:
+		c, err := dialSSHConsole(ctx, console)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return DialTelnet(ctx, console.GetAddress())
+	}
+}
+
+// telnetConsole is a console line exposed over telnet. Option negotiations
+// are answered so that the terminal server sends plain character data, and are
+// removed from the output.
+type telnetConsole struct {
+	conn net.Conn
+
+	wmu sync.Mutex // serializes writes of user data and negotiation replies
+
+	// Parser state, only accessed by Read.
+	state telnetState
+	cmd   byte
+}
+
+// DialTelnet connects to a console line exposed over telnet at addr.
+func DialTelnet(ctx context.Context, addr string) (binding.ConsoleClient, error) {
+	d := net.Dialer{Timeout: consoleDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial console %s: %v", addr, err)
+	}
+	return &telnetConsole{conn: conn}, nil
+}
+
+func (c *telnetConsole) Stdin() io.WriteCloser {
+	return c
+}
+
+func (c *telnetConsole) Stdout() io.ReadCloser {
+	return c
+}
+
+// Stderr returns an empty stream, telnet has no separate error stream.
+func (c *telnetConsole) Stderr() io.ReadCloser {
+	return io.NopCloser(strings.NewReader(""))
+}
+
+func (c *telnetConsole) Close() error {
+	return c.conn.Close()
+}
+
+// Read returns console data with telnet commands removed.
+func (c *telnetConsole) Read(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	for {
+		n, err := c.conn.Read(buf)
+		if out := c.parse(buf[:n], p); out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+// parse copies the data bytes of in to out and answers option negotiations.
+// out must be at least as large as in.
+func (c *telnetConsole) parse(in, out []byte) int {
+	n := 0
+	for _, b := range in {
+		switch c.state {
+		case telnetData:
+			if b == telnetIAC {
+				c.state = telnetCommand
+				continue
+			}
+			out[n] = b
+			n++
+		case telnetCommand:
+			switch b {
+			case telnetIAC:
+				out[n] = b
+				n++
+				c.state = telnetData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				c.cmd = b
+				c.state = telnetOption
+			case telnetSB:
+				c.state = telnetSubnegotiation
+			default:
+				c.state = telnetData
+			}
+		case telnetOption:
+			c.negotiate(c.cmd, b)
+			c.state = telnetData
+		case telnetSubnegotiation:
+			if b == telnetIAC {
+				c.state = telnetSubnegotiationIAC
+			}
+		case telnetSubnegotiationIAC:
+			if b == telnetSE {
+				c.state = telnetData
+			} else {
+				c.state = telnetSubnegotiation
+			}
+		}
+	}
+	return n
+}
+
+// negotiate accepts the server echoing and suppressing go-ahead, which is
+// what terminal servers expect from a character mode client, and refuses all
+// other options.
+func (c *telnetConsole) negotiate(cmd, opt byte) {
+	var reply byte
+	switch cmd {
+	case telnetWILL:
+		reply = telnetDONT
+		if opt == telnetOptEcho || opt == telnetOptSGA {
+			reply = telnetDO
+		}
+	case telnetDO:
+		reply = telnetWONT
+	default:
+		return
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.Write([]byte{telnetIAC, reply, opt})
+}
+
+// Write sends data to the console line, escaping IAC bytes.
+func (c *telnetConsole) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p))
+	for _, b := range p {
+		if b == telnetIAC {
+			buf = append(buf, telnetIAC)
+		}
+		buf = append(buf, b)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sshConsole is a console line exposed over SSH by the terminal server.
+type sshConsole struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	stderr  io.Reader
+}
+
+// consoleReader closes the whole console when the stream is closed.
+type consoleReader struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r consoleReader) Close() error {
+	return r.closer.Close()
+}
+
+func dialSSHConsole(ctx context.Context, console *inpb.Console) (*sshConsole, error) {
+	addr := console.GetAddress()
+	d := net.Dialer{Timeout: consoleDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial console %s: %v", addr, err)
+	}
+
+	config := &ssh.ClientConfig{
+		User:            console.GetUsername(),
+		Auth:            []ssh.AuthMethod{ssh.Password(console.GetPassword())},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         consoleDialTimeout,
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open SSH connection to console %s: %v", addr, err)
+	}
+
+	c := &sshConsole{client: ssh.NewClient(sshConn, chans, reqs)}
+	if err := c.start(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to open console %s: %v", addr, err)
+	}
+	return c, nil
+}
+
+// start opens an interactive session on the console line.
+func (c *sshConsole) start() error {
+	var err error
+	if c.session, err = c.client.NewSession(); err != nil {
+		return err
+	}
+	if c.stdin, err = c.session.StdinPipe(); err != nil {
+		return err
+	}
+	if c.stdout, err = c.session.StdoutPipe(); err != nil {
+		return err
+	}
+	if c.stderr, err = c.session.StderrPipe(); err != nil {
+		return err
+	}
+	if err := c.session.RequestPty("vt100", 80, 200, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+		return err
+	}
+	return c.session.Shell()
+}
+
+func (c *sshConsole) Stdin() io.WriteCloser {
+	return c.stdin
+}
+
+func (c *sshConsole) Stdout() io.ReadCloser {
+	return consoleReader{Reader: c.stdout, closer: c}
+}
+
+func (c *sshConsole) Stderr() io.ReadCloser {
+	return consoleReader{Reader: c.stderr, closer: c}
+}
+
+func (c *sshConsole) Close() error {
+	if c.session != nil {
+		c.session.Close()
+	}
+	return c.client.Close()
+}
@@ -0,0 +1,148 @@
+package pinsbackend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+
+	inpb "github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/proto/inventory"
+)
+
+// Default TLS material used for certificate paths missing from the inventory.
+const (
+	defaultCACert     = "ondatra/certs/ca_crt.pem"
+	defaultClientCert = "ondatra/certs/client_crt.pem"
+	defaultClientKey  = "ondatra/certs/client_key.pem"
+)
+
+// CredentialProvider supplies the credentials used to dial the gRPC services
+// of the reserved DUTs.
+type CredentialProvider interface {
+	// TransportCredentials returns the transport credentials used for the
+	// service of the device.
+	TransportCredentials(dev *inpb.Device, service bindingbackend.GRPCService) (credentials.TransportCredentials, error)
+	// PerRPCCredentials returns the credentials attached to every RPC sent to
+	// the service of the device, or nil if there are none.
+	PerRPCCredentials(dev *inpb.Device, service bindingbackend.GRPCService) (credentials.PerRPCCredentials, error)
+}
+
+// InventoryCredentials provides the credentials configured in the inventory
+// for the given security mode:
+// - insecure: plaintext connections.
+// - tls: the server is authenticated with the inventory CA, or the system CAs
+// if the inventory has none.
+// - mtls: the server and the client are authenticated, the default certs in
+// ondatra/certs are used for paths missing from the inventory.
+type InventoryCredentials struct {
+	mode string
+}
+
+// NewInventoryCredentials returns a provider for the given security mode.
+func NewInventoryCredentials(mode string) (*InventoryCredentials, error) {
+	for _, m := range supportedSecurityModes {
+		if m == mode {
+			return &InventoryCredentials{mode: mode}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported security mode %q, choose from %v", mode, supportedSecurityModes)
+}
+
+// serviceCerts returns the certs of the device overridden by the certs of the
+// service.
+func serviceCerts(dev *inpb.Device, service bindingbackend.GRPCService) *inpb.Certs {
+	certs := &inpb.Certs{}
+	if dev.GetCerts() != nil {
+		certs = proto.Clone(dev.GetCerts()).(*inpb.Certs)
+	}
+	if sc, ok := dev.GetServiceCerts()[string(service)]; ok {
+		proto.Merge(certs, sc)
+	}
+	return certs
+}
+
+// TransportCredentials returns the TLS credentials of the service.
+func (c *InventoryCredentials) TransportCredentials(dev *inpb.Device, service bindingbackend.GRPCService) (credentials.TransportCredentials, error) {
+	if c.mode == "insecure" {
+		return insecure.NewCredentials(), nil
+	}
+
+	certs := serviceCerts(dev, service)
+	config := &tls.Config{
+		ServerName: dev.GetName(),
+		MinVersion: tls.VersionTLS13,
+	}
+	if certs.GetServerName() != "" {
+		config.ServerName = certs.GetServerName()
+	}
+
+	caCert := certs.GetCaCert()
+	if caCert == "" && c.mode == "mtls" {
+		caCert = defaultCACert
+	}
+	if caCert != "" {
+		// Load certificate of the CA who signed server's certificate.
+		pemServerCA, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pemServerCA) {
+			return nil, fmt.Errorf("failed to add server CA's certificate %s", caCert)
+		}
+	}
+
+	if c.mode == "mtls" {
+		clientCert, clientKey := defaultClientCert, defaultClientKey
+		if certs.GetClientCert() != "" {
+			clientCert = certs.GetClientCert()
+		}
+		if certs.GetClientKey() != "" {
+			clientKey = certs.GetClientKey()
+		}
+		// Load client's certificate and private key
+		clientKeyPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{clientKeyPair}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// PerRPCCredentials returns the username and password of the device, if any.
+func (c *InventoryCredentials) PerRPCCredentials(dev *inpb.Device, service bindingbackend.GRPCService) (credentials.PerRPCCredentials, error) {
+	if dev.GetCredentials().GetUsername() == "" {
+		return nil, nil
+	}
+	return &passwordCredentials{
+		username: dev.GetCredentials().GetUsername(),
+		password: dev.GetCredentials().GetPassword(),
+		secure:   c.mode != "insecure",
+	}, nil
+}
+
+// passwordCredentials sends the username and password as metadata of every
+// RPC.
+type passwordCredentials struct {
+	username string
+	password string
+	secure   bool
+}
+
+func (c *passwordCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"username": c.username,
+		"password": c.password,
+	}, nil
+}
+
+func (c *passwordCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
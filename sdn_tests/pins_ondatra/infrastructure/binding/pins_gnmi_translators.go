@@ -0,0 +1,284 @@
+package pinsbind
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// GNMITranslator adapts the gNMI messages exchanged with a DUT to the quirks
+// of its gNMI server. Translators modify the messages in place; requests are
+// copies owned by the binding, so callers never see the translated requests.
+// Embed NopGNMITranslator to only implement the methods that are needed.
+type GNMITranslator interface {
+	GetRequest(*gpb.GetRequest) error
+	GetResponse(*gpb.GetResponse) error
+	SetRequest(*gpb.SetRequest) error
+	SetResponse(*gpb.SetResponse) error
+	SubscribeRequest(*gpb.SubscribeRequest) error
+	SubscribeResponse(*gpb.SubscribeResponse) error
+	CapabilityRequest(*gpb.CapabilityRequest) error
+	CapabilityResponse(*gpb.CapabilityResponse) error
+}
+
+// NopGNMITranslator leaves all messages untouched.
+type NopGNMITranslator struct{}
+
+func (NopGNMITranslator) GetRequest(*gpb.GetRequest) error                 { return nil }
+func (NopGNMITranslator) GetResponse(*gpb.GetResponse) error               { return nil }
+func (NopGNMITranslator) SetRequest(*gpb.SetRequest) error                 { return nil }
+func (NopGNMITranslator) SetResponse(*gpb.SetResponse) error               { return nil }
+func (NopGNMITranslator) SubscribeRequest(*gpb.SubscribeRequest) error     { return nil }
+func (NopGNMITranslator) SubscribeResponse(*gpb.SubscribeResponse) error   { return nil }
+func (NopGNMITranslator) CapabilityRequest(*gpb.CapabilityRequest) error   { return nil }
+func (NopGNMITranslator) CapabilityResponse(*gpb.CapabilityResponse) error { return nil }
+
+type registeredTranslator struct {
+	name       string
+	translator GNMITranslator
+	enabled    bool // enabled by default
+}
+
+var (
+	translatorsMu sync.Mutex
+	translators   []*registeredTranslator
+)
+
+// translatorList is the value of the --gnmi_translators flag.
+type translatorList struct {
+	names []string
+	set   bool
+}
+
+func (l *translatorList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.names, ",")
+}
+
+func (l *translatorList) Set(v string) error {
+	l.names, l.set = nil, true
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			l.names = append(l.names, name)
+		}
+	}
+	return nil
+}
+
+var enabledTranslators translatorList
+
+func init() {
+	flag.Var(&enabledTranslators, "gnmi_translators", "comma-separated gNMI translators applied to the gNMI traffic with the DUTs, in registration order; an empty list disables all of them. Defaults to the translators enabled by default (wrap_json_ietf).")
+
+	RegisterGNMITranslator("wrap_json_ietf", wrapJSONIETF{}, true)
+	RegisterGNMITranslator("strip_openconfig_origin", stripOpenconfigOrigin{}, false)
+	RegisterGNMITranslator("json_to_json_ietf", jsonToJSONIETF{}, false)
+}
+
+// RegisterGNMITranslator adds a translator to the end of the gNMI translation
+// chain. Translators enabled by default are used unless --gnmi_translators
+// selects other ones. It must be called before the DUTs are dialed, e.g. from
+// an init function.
+func RegisterGNMITranslator(name string, t GNMITranslator, enabledByDefault bool) {
+	translatorsMu.Lock()
+	defer translatorsMu.Unlock()
+	for _, r := range translators {
+		if r.name == name {
+			panic(fmt.Sprintf("gNMI translator %q registered twice", name))
+		}
+	}
+	translators = append(translators, &registeredTranslator{name: name, translator: t, enabled: enabledByDefault})
+}
+
+// gnmiChain returns the enabled translators in registration order.
+func gnmiChain() ([]*registeredTranslator, error) {
+	translatorsMu.Lock()
+	defer translatorsMu.Unlock()
+	if !enabledTranslators.set {
+		var chain []*registeredTranslator
+		for _, r := range translators {
+			if r.enabled {
+				chain = append(chain, r)
+			}
+		}
+		return chain, nil
+	}
+
+	enabled := map[string]bool{}
+	for _, name := range enabledTranslators.names {
+		enabled[name] = true
+	}
+	var chain []*registeredTranslator
+	for _, r := range translators {
+		if enabled[r.name] {
+			chain = append(chain, r)
+			delete(enabled, r.name)
+		}
+	}
+	if len(enabled) > 0 {
+		var unknown []string
+		for name := range enabled {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown gNMI translators %v in --gnmi_translators", unknown)
+	}
+	return chain, nil
+}
+
+// translateRequest applies the translators to a request in chain order.
+func translateRequest(chain []*registeredTranslator, f func(t GNMITranslator) error) error {
+	for _, r := range chain {
+		if err := f(r.translator); err != nil {
+			return fmt.Errorf("gNMI translator %s: %v", r.name, err)
+		}
+	}
+	return nil
+}
+
+// translateResponse applies the translators to a response in reverse chain
+// order, so that the first translator sees the final response.
+func translateResponse(chain []*registeredTranslator, f func(t GNMITranslator) error) error {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := f(chain[i].translator); err != nil {
+			return fmt.Errorf("gNMI translator %s: %v", chain[i].name, err)
+		}
+	}
+	return nil
+}
+
+// wrapJSONIETF wraps the JSON IETF values of Set requests in their container,
+// as expected by the PINS gNMI server.
+type wrapJSONIETF struct {
+	NopGNMITranslator
+}
+
+func (wrapJSONIETF) SetRequest(req *gpb.SetRequest) error {
+	for _, up := range req.GetReplace() {
+		if err := wrapValueInUpdate(up); err != nil {
+			return err
+		}
+	}
+	for _, up := range req.GetUpdate() {
+		if err := wrapValueInUpdate(up); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrapValueInUpdate wraps the typed value in the provided update into a
+// serialized JSON node., e.g.
+// - 123 -> {"foo": 123}
+// - [{"str": "one"}] -> {"foo": [{"str": "one"}]}
+// - {"str": "test-string"} -> {"foo": {"str": "test-string"}}
+func wrapValueInUpdate(up *gpb.Update) error {
+	elems := up.GetPath().GetElem()
+	if len(elems) == 0 {
+		// root path case
+		return nil
+	}
+	name := elems[len(elems)-1].GetName()
+	var i any
+	if err := json.Unmarshal(up.GetVal().GetJsonIetfVal(), &i); err != nil {
+		return fmt.Errorf("unable to unmarshal config: %v", err)
+	}
+
+	// For list paths such as /interfaces/interface[name=<key>], JSON IETF value
+	// needs to be an array instead of an object. Ondatra returns value for such paths
+	// as an object, which need to be translated into a JSON array. E.g.
+	// - {"str": "test-string"} -> [{"str": "test-string"}]
+	if len(elems[len(elems)-1].GetKey()) > 0 {
+		// The path is a list node. Perform translation to JSON array.
+		var arr []any
+		arr = append(arr, i)
+		arrVal, err := json.Marshal(arr)
+		if err != nil {
+			return fmt.Errorf("unable to marshal value %v as a JSON array: %v", arr, err)
+		}
+		if err := json.Unmarshal(arrVal, &i); err != nil {
+			return fmt.Errorf("unable to unmarshal JSON array config: %v", err)
+		}
+	}
+	js, err := json.MarshalIndent(map[string]any{name: i}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal config with wrapping container: %v", err)
+	}
+	up.GetVal().Value = &gpb.TypedValue_JsonIetfVal{js}
+	return nil
+}
+
+// stripOpenconfigOrigin removes the "openconfig" origin from request paths
+// for servers that only accept the default origin.
+type stripOpenconfigOrigin struct {
+	NopGNMITranslator
+}
+
+func stripOrigin(p *gpb.Path) {
+	if p.GetOrigin() == "openconfig" {
+		p.Origin = ""
+	}
+}
+
+func (stripOpenconfigOrigin) GetRequest(req *gpb.GetRequest) error {
+	stripOrigin(req.GetPrefix())
+	for _, p := range req.GetPath() {
+		stripOrigin(p)
+	}
+	return nil
+}
+
+func (stripOpenconfigOrigin) SetRequest(req *gpb.SetRequest) error {
+	stripOrigin(req.GetPrefix())
+	for _, p := range req.GetDelete() {
+		stripOrigin(p)
+	}
+	for _, up := range append(append([]*gpb.Update(nil), req.GetReplace()...), req.GetUpdate()...) {
+		stripOrigin(up.GetPath())
+	}
+	return nil
+}
+
+func (stripOpenconfigOrigin) SubscribeRequest(req *gpb.SubscribeRequest) error {
+	stripOrigin(req.GetSubscribe().GetPrefix())
+	for _, sub := range req.GetSubscribe().GetSubscription() {
+		stripOrigin(sub.GetPath())
+	}
+	return nil
+}
+
+// jsonToJSONIETF requests and sends JSON IETF instead of JSON values for
+// servers that only support JSON IETF.
+type jsonToJSONIETF struct {
+	NopGNMITranslator
+}
+
+func (jsonToJSONIETF) GetRequest(req *gpb.GetRequest) error {
+	if req.GetEncoding() == gpb.Encoding_JSON {
+		req.Encoding = gpb.Encoding_JSON_IETF
+	}
+	return nil
+}
+
+func (jsonToJSONIETF) SetRequest(req *gpb.SetRequest) error {
+	for _, up := range append(append([]*gpb.Update(nil), req.GetReplace()...), req.GetUpdate()...) {
+		if v, ok := up.GetVal().GetValue().(*gpb.TypedValue_JsonVal); ok {
+			up.GetVal().Value = &gpb.TypedValue_JsonIetfVal{v.JsonVal}
+		}
+	}
+	return nil
+}
+
+func (jsonToJSONIETF) SubscribeRequest(req *gpb.SubscribeRequest) error {
+	if s := req.GetSubscribe(); s != nil && s.GetEncoding() == gpb.Encoding_JSON {
+		s.Encoding = gpb.Encoding_JSON_IETF
+	}
+	return nil
+}
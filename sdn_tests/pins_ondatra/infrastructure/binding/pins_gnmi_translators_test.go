@@ -0,0 +1,422 @@
+package pinsbind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/ygot/ygot"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func mustPath(t *testing.T, s string) *gpb.Path {
+	t.Helper()
+	p, err := ygot.StringToStructuredPath(s)
+	if err != nil {
+		t.Fatalf("StringToStructuredPath(%s) failed: %v", s, err)
+	}
+	return p
+}
+
+func jsonIETFUpdate(t *testing.T, path, js string) *gpb.Update {
+	t.Helper()
+	return &gpb.Update{
+		Path: mustPath(t, path),
+		Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(js)}},
+	}
+}
+
+func TestWrapJSONIETF(t *testing.T) {
+	tests := []struct {
+		desc    string
+		path    string
+		val     string
+		want    string
+		wantErr bool
+	}{{
+		desc: "leaf",
+		path: "/interfaces/interface[name=Ethernet1/1/1]/config/mtu",
+		val:  `9100`,
+		want: `{"mtu":9100}`,
+	}, {
+		desc: "container",
+		path: "/interfaces/interface[name=Ethernet1/1/1]/config",
+		val:  `{"description":"test"}`,
+		want: `{"config":{"description":"test"}}`,
+	}, {
+		desc: "list entry",
+		path: "/interfaces/interface[name=Ethernet1/1/1]",
+		val:  `{"name":"Ethernet1/1/1"}`,
+		want: `{"interface":[{"name":"Ethernet1/1/1"}]}`,
+	}, {
+		desc: "root",
+		path: "/",
+		val:  `{"openconfig-interfaces:interfaces":{}}`,
+		want: `{"openconfig-interfaces:interfaces":{}}`,
+	}, {
+		desc:    "invalid JSON",
+		path:    "/interfaces/interface[name=Ethernet1/1/1]/config/mtu",
+		val:     `{`,
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			// Replaced and updated values are wrapped alike.
+			req := &gpb.SetRequest{
+				Replace: []*gpb.Update{jsonIETFUpdate(t, tt.path, tt.val)},
+				Update:  []*gpb.Update{jsonIETFUpdate(t, tt.path, tt.val)},
+			}
+			err := wrapJSONIETF{}.SetRequest(req)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("SetRequest() = %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for _, up := range append(req.GetReplace(), req.GetUpdate()...) {
+				var got, want any
+				if err := json.Unmarshal(up.GetVal().GetJsonIetfVal(), &got); err != nil {
+					t.Fatalf("Translated value %s is not JSON: %v", up.GetVal().GetJsonIetfVal(), err)
+				}
+				if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+					t.Fatalf("Invalid wanted value %s: %v", tt.want, err)
+				}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("Translated value differs (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestStripOpenconfigOrigin(t *testing.T) {
+	oc := func(s string) *gpb.Path {
+		p := mustPath(t, s)
+		p.Origin = "openconfig"
+		return p
+	}
+	stripped := func(s string) *gpb.Path {
+		return mustPath(t, s)
+	}
+	other := func(s string) *gpb.Path {
+		p := mustPath(t, s)
+		p.Origin = "cli"
+		return p
+	}
+	const path = "/interfaces/interface[name=Ethernet1/1/1]/config/mtu"
+
+	tests := []struct {
+		desc      string
+		translate func(GNMITranslator, proto.Message) error
+		req, want proto.Message
+	}{{
+		desc:      "Get",
+		translate: func(tr GNMITranslator, m proto.Message) error { return tr.GetRequest(m.(*gpb.GetRequest)) },
+		req:       &gpb.GetRequest{Prefix: oc("/"), Path: []*gpb.Path{oc(path), other(path)}},
+		want:      &gpb.GetRequest{Prefix: stripped("/"), Path: []*gpb.Path{stripped(path), other(path)}},
+	}, {
+		desc:      "Set",
+		translate: func(tr GNMITranslator, m proto.Message) error { return tr.SetRequest(m.(*gpb.SetRequest)) },
+		req: &gpb.SetRequest{
+			Prefix:  oc("/"),
+			Delete:  []*gpb.Path{oc(path)},
+			Replace: []*gpb.Update{{Path: oc(path)}},
+			Update:  []*gpb.Update{{Path: other(path)}},
+		},
+		want: &gpb.SetRequest{
+			Prefix:  stripped("/"),
+			Delete:  []*gpb.Path{stripped(path)},
+			Replace: []*gpb.Update{{Path: stripped(path)}},
+			Update:  []*gpb.Update{{Path: other(path)}},
+		},
+	}, {
+		desc:      "Subscribe",
+		translate: func(tr GNMITranslator, m proto.Message) error { return tr.SubscribeRequest(m.(*gpb.SubscribeRequest)) },
+		req: &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+			Prefix:       oc("/"),
+			Subscription: []*gpb.Subscription{{Path: oc(path)}},
+		}}},
+		want: &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+			Prefix:       stripped("/"),
+			Subscription: []*gpb.Subscription{{Path: stripped(path)}},
+		}}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if err := tt.translate(stripOpenconfigOrigin{}, tt.req); err != nil {
+				t.Fatalf("Translation failed: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, tt.req, protocmp.Transform()); diff != "" {
+				t.Errorf("Translated request differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJSONToJSONIETF(t *testing.T) {
+	const path = "/interfaces/interface[name=Ethernet1/1/1]/config/mtu"
+	jsonUpdate := &gpb.Update{Path: mustPath(t, path), Val: &gpb.TypedValue{Value: &gpb.TypedValue_JsonVal{JsonVal: []byte(`9100`)}}}
+	protoUpdate := &gpb.Update{Path: mustPath(t, path), Val: &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: 9100}}}
+
+	tests := []struct {
+		desc      string
+		translate func(GNMITranslator, proto.Message) error
+		req, want proto.Message
+	}{{
+		desc:      "Get JSON",
+		translate: func(tr GNMITranslator, m proto.Message) error { return tr.GetRequest(m.(*gpb.GetRequest)) },
+		req:       &gpb.GetRequest{Encoding: gpb.Encoding_JSON},
+		want:      &gpb.GetRequest{Encoding: gpb.Encoding_JSON_IETF},
+	}, {
+		desc:      "Get PROTO",
+		translate: func(tr GNMITranslator, m proto.Message) error { return tr.GetRequest(m.(*gpb.GetRequest)) },
+		req:       &gpb.GetRequest{Encoding: gpb.Encoding_PROTO},
+		want:      &gpb.GetRequest{Encoding: gpb.Encoding_PROTO},
+	}, {
+		desc:      "Set",
+		translate: func(tr GNMITranslator, m proto.Message) error { return tr.SetRequest(m.(*gpb.SetRequest)) },
+		req: &gpb.SetRequest{
+			Replace: []*gpb.Update{proto.Clone(jsonUpdate).(*gpb.Update)},
+			Update:  []*gpb.Update{proto.Clone(jsonUpdate).(*gpb.Update), proto.Clone(protoUpdate).(*gpb.Update)},
+		},
+		want: &gpb.SetRequest{
+			Replace: []*gpb.Update{jsonIETFUpdate(t, path, `9100`)},
+			Update:  []*gpb.Update{jsonIETFUpdate(t, path, `9100`), protoUpdate},
+		},
+	}, {
+		desc:      "Subscribe",
+		translate: func(tr GNMITranslator, m proto.Message) error { return tr.SubscribeRequest(m.(*gpb.SubscribeRequest)) },
+		req: &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+			Encoding: gpb.Encoding_JSON,
+		}}},
+		want: &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+			Encoding: gpb.Encoding_JSON_IETF,
+		}}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if err := tt.translate(jsonToJSONIETF{}, tt.req); err != nil {
+				t.Fatalf("Translation failed: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, tt.req, protocmp.Transform()); diff != "" {
+				t.Errorf("Translated request differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTranslatorListSet(t *testing.T) {
+	tests := []struct {
+		flag string
+		want []string
+	}{
+		{flag: "wrap_json_ietf", want: []string{"wrap_json_ietf"}},
+		{flag: "wrap_json_ietf,strip_openconfig_origin", want: []string{"wrap_json_ietf", "strip_openconfig_origin"}},
+		{flag: " wrap_json_ietf , ,strip_openconfig_origin ", want: []string{"wrap_json_ietf", "strip_openconfig_origin"}},
+		{flag: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		l := &translatorList{}
+		if err := l.Set(tt.flag); err != nil {
+			t.Fatalf("Set(%q) failed: %v", tt.flag, err)
+		}
+		if !l.set {
+			t.Errorf("Set(%q) left the list unset", tt.flag)
+		}
+		if diff := cmp.Diff(tt.want, l.names); diff != "" {
+			t.Errorf("Set(%q) names differ (-want +got):\n%s", tt.flag, diff)
+		}
+	}
+}
+
+// recordingTranslator appends its name to calls for every translated message
+// and fails with err.
+type recordingTranslator struct {
+	NopGNMITranslator
+	name  string
+	calls *[]string
+	err   error
+}
+
+func (r recordingTranslator) GetRequest(*gpb.GetRequest) error {
+	*r.calls = append(*r.calls, r.name)
+	return r.err
+}
+
+func (r recordingTranslator) GetResponse(*gpb.GetResponse) error {
+	*r.calls = append(*r.calls, r.name)
+	return r.err
+}
+
+func (r recordingTranslator) SubscribeResponse(*gpb.SubscribeResponse) error {
+	*r.calls = append(*r.calls, r.name)
+	return r.err
+}
+
+// setTranslators replaces the registered translators and the
+// --gnmi_translators flag for the test.
+func setTranslators(t *testing.T, registered []*registeredTranslator, flag *string) {
+	t.Helper()
+	savedTranslators, savedFlag := translators, enabledTranslators
+	t.Cleanup(func() {
+		translators, enabledTranslators = savedTranslators, savedFlag
+	})
+	translators, enabledTranslators = registered, translatorList{}
+	if flag != nil {
+		if err := enabledTranslators.Set(*flag); err != nil {
+			t.Fatalf("Set(%q) failed: %v", *flag, err)
+		}
+	}
+}
+
+func TestGNMIChain(t *testing.T) {
+	registered := []*registeredTranslator{
+		{name: "a", translator: NopGNMITranslator{}, enabled: true},
+		{name: "b", translator: NopGNMITranslator{}},
+		{name: "c", translator: NopGNMITranslator{}, enabled: true},
+	}
+	flag := func(s string) *string { return &s }
+
+	tests := []struct {
+		desc    string
+		flag    *string
+		want    []string
+		wantErr string
+	}{{
+		desc: "defaults",
+		want: []string{"a", "c"},
+	}, {
+		desc: "registration order",
+		flag: flag("c,b"),
+		want: []string{"b", "c"},
+	}, {
+		desc: "disabled",
+		flag: flag(""),
+	}, {
+		desc:    "unknown",
+		flag:    flag("a,x,y"),
+		wantErr: "unknown gNMI translators [x y]",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			setTranslators(t, registered, tt.flag)
+			chain, err := gnmiChain()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("gnmiChain() = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("gnmiChain() failed: %v", err)
+			}
+			var got []string
+			for _, r := range chain {
+				got = append(got, r.name)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("gnmiChain() differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTranslateChain(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		desc string
+		// failing is the translator that fails, if any.
+		failing       string
+		wantRequests  []string
+		wantResponses []string
+		wantErr       string
+	}{{
+		desc:          "all succeed",
+		wantRequests:  []string{"a", "b", "c"},
+		wantResponses: []string{"c", "b", "a"},
+	}, {
+		desc:          "failure stops the chain",
+		failing:       "b",
+		wantRequests:  []string{"a", "b"},
+		wantResponses: []string{"c", "b"},
+		wantErr:       "gNMI translator b: failed",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			var calls []string
+			var chain []*registeredTranslator
+			for _, name := range []string{"a", "b", "c"} {
+				tr := recordingTranslator{name: name, calls: &calls}
+				if name == tt.failing {
+					tr.err = errFailed
+				}
+				chain = append(chain, &registeredTranslator{name: name, translator: tr})
+			}
+			checkErr := func(fn string, err error) {
+				t.Helper()
+				if (tt.wantErr == "" && err != nil) || (tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr)) {
+					t.Errorf("%s() = %v, want error %q", fn, err, tt.wantErr)
+				}
+			}
+
+			err := translateRequest(chain, func(t GNMITranslator) error { return t.GetRequest(&gpb.GetRequest{}) })
+			checkErr("translateRequest", err)
+			if diff := cmp.Diff(tt.wantRequests, calls); diff != "" {
+				t.Errorf("Request translation order differs (-want +got):\n%s", diff)
+			}
+
+			calls = nil
+			err = translateResponse(chain, func(t GNMITranslator) error { return t.GetResponse(&gpb.GetResponse{}) })
+			checkErr("translateResponse", err)
+			if diff := cmp.Diff(tt.wantResponses, calls); diff != "" {
+				t.Errorf("Response translation order differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// responseStream is a Subscribe stream receiving a single response.
+type responseStream struct {
+	gpb.GNMI_SubscribeClient
+	ctx context.Context
+}
+
+func (s *responseStream) Recv() (*gpb.SubscribeResponse, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}}, nil
+}
+
+func TestSubscribeRecvTranslationFailure(t *testing.T) {
+	var calls []string
+	c := &clientWrap{dut: "dut", chain: []*registeredTranslator{
+		{name: "failing", translator: recordingTranslator{name: "failing", calls: &calls, err: errors.New("failed")}},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sc := &subscribeClientWrap{
+		GNMI_SubscribeClient: &responseStream{ctx: ctx},
+		client:               c,
+		sub:                  openSubscriptions.add(ctx, c.dut, cancel),
+	}
+
+	if _, err := sc.Recv(); err == nil {
+		t.Fatalf("Recv() with a failing translator succeeded, want an error")
+	}
+	if ctx.Err() == nil {
+		t.Errorf("Stream is still open after the translation of a response failed")
+	}
+}
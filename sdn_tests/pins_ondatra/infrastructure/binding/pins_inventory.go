@@ -0,0 +1,494 @@
+package pinsbackend
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra/binding"
+	opb "github.com/openconfig/ondatra/proto"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	inpb "github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/proto/inventory"
+)
+
+// defaultGRPCPorts contains the ports used for services that have no address
+// in the inventory.
+var defaultGRPCPorts = map[bindingbackend.GRPCService]string{
+	bindingbackend.GNMI:  "9339",
+	bindingbackend.GNOI:  "9339",
+	bindingbackend.GNSI:  "9339",
+	bindingbackend.GRIBI: "9340",
+	bindingbackend.P4RT:  "9559",
+}
+
+// defaultATEGRPCPorts contains the ports used for ATE services that have no
+// address in the inventory.
+var defaultATEGRPCPorts = map[bindingbackend.GRPCService]string{
+	bindingbackend.OTG: "40051",
+}
+
+// LoadInventory reads the testbed inventory from the given file. Files with a
+// .yaml or .yml extension are parsed as YAML, any other file as textproto.
+func LoadInventory(path string) (*inpb.Inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %s: %v", path, err)
+	}
+
+	inv := &inpb.Inventory{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		js, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert YAML inventory %s to JSON: %v", path, err)
+		}
+		if err := protojson.Unmarshal(js, inv); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML inventory %s: %v", path, err)
+		}
+	default:
+		if err := prototext.Unmarshal(data, inv); err != nil {
+			return nil, fmt.Errorf("failed to parse textproto inventory %s: %v", path, err)
+		}
+	}
+
+	if err := validateInventory(inv); err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %v", path, err)
+	}
+	return inv, nil
+}
+
+// validateInventory checks that device and port names are set and unique.
+func validateInventory(inv *inpb.Inventory) error {
+	if len(inv.GetDuts()) == 0 {
+		return fmt.Errorf("no DUTs defined")
+	}
+	devices := map[string]bool{}
+	for _, dev := range append(append([]*inpb.Device(nil), inv.GetDuts()...), inv.GetAtes()...) {
+		if dev.GetName() == "" {
+			return fmt.Errorf("device %q has no name", dev.GetId())
+		}
+		if devices[dev.GetName()] {
+			return fmt.Errorf("device %q defined more than once", dev.GetName())
+		}
+		devices[dev.GetName()] = true
+		if v := dev.GetVendor(); v != "" {
+			if _, ok := opb.Device_Vendor_value[v]; !ok {
+				return fmt.Errorf("device %q has unknown vendor %q", dev.GetName(), v)
+			}
+		}
+
+		ports := map[string]bool{}
+		for _, p := range dev.GetPorts() {
+			if p.GetName() == "" {
+				return fmt.Errorf("device %q has a port without name", dev.GetName())
+			}
+			if ports[p.GetName()] {
+				return fmt.Errorf("port %q defined more than once on device %q", p.GetName(), dev.GetName())
+			}
+			ports[p.GetName()] = true
+		}
+	}
+
+	// Every port can only be cabled once.
+	cabled := map[string]bool{}
+	for _, l := range inv.GetLinks() {
+		for _, end := range []*inpb.LinkEnd{l.GetA(), l.GetB()} {
+			if !hasPort(inv, end) {
+				return fmt.Errorf("link end %s:%s is not a port of the inventory", end.GetDevice(), end.GetPort())
+			}
+			key := end.GetDevice() + ":" + end.GetPort()
+			if cabled[key] {
+				return fmt.Errorf("port %s is part of more than one link", key)
+			}
+			cabled[key] = true
+		}
+	}
+	return nil
+}
+
+// hasPort returns true if the inventory has the port of the link end.
+func hasPort(inv *inpb.Inventory, end *inpb.LinkEnd) bool {
+	for _, dev := range append(append([]*inpb.Device(nil), inv.GetDuts()...), inv.GetAtes()...) {
+		if dev.GetName() != end.GetDevice() {
+			continue
+		}
+		for _, p := range dev.GetPorts() {
+			if p.GetName() == end.GetPort() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// partialMapping holds the user pinned devices and ports of a partial
+// reservation, keyed by testbed IDs.
+type partialMapping struct {
+	devices map[string]string            // testbed device ID -> device name
+	ports   map[string]map[string]string // testbed device ID -> testbed port ID -> port name
+}
+
+// parsePartial validates the partial mapping passed by Ondatra against the
+// testbed. Keys are either a testbed DUT or ATE ID, e.g. "DUT", or a testbed
+// port ID qualified by its device ID, e.g. "DUT:port1".
+func parsePartial(tb *opb.Testbed, partial map[string]string) (*partialMapping, error) {
+	devPorts := map[string]map[string]bool{}
+	for _, dev := range append(append([]*opb.Device(nil), tb.GetDuts()...), tb.GetAtes()...) {
+		devPorts[dev.GetId()] = map[string]bool{}
+		for _, p := range dev.GetPorts() {
+			devPorts[dev.GetId()][p.GetId()] = true
+		}
+	}
+
+	m := &partialMapping{devices: map[string]string{}, ports: map[string]map[string]string{}}
+	for key, name := range partial {
+		devID, portID, isPort := strings.Cut(key, ":")
+		ports, ok := devPorts[devID]
+		if !ok {
+			return nil, fmt.Errorf("partial mapping %s=%s: testbed has no device %q", key, name, devID)
+		}
+		if !isPort {
+			m.devices[devID] = name
+			continue
+		}
+		if !ports[portID] {
+			return nil, fmt.Errorf("partial mapping %s=%s: testbed device %q has no port %q", key, name, devID, portID)
+		}
+		if m.ports[devID] == nil {
+			m.ports[devID] = map[string]string{}
+		}
+		m.ports[devID][portID] = name
+	}
+	return m, nil
+}
+
+// hasPorts returns true if the device has all the given port names.
+func hasPorts(dev *inpb.Device, names map[string]string) bool {
+	for _, name := range names {
+		found := false
+		for _, p := range dev.GetPorts() {
+			if p.GetName() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTestbed assigns an inventory device to every DUT and ATE of the
+// testbed and an inventory port to every requested port. Devices and ports
+// pinned by the partial mapping are assigned first. The other devices are
+// searched for an assignment where every testbed device gets enough ports,
+// preferring the devices whose ID matches the testbed ID and then the
+// inventory order. Ports prefer the inventory ports with the testbed port ID,
+// the remaining ones are assigned in inventory order. The returned topology
+// has no ID and links.
+func matchTestbed(inv *inpb.Inventory, tb *opb.Testbed, partial map[string]string) (*bindingbackend.ReservedTopology, error) {
+	pins, err := parsePartial(tb, partial)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &bindingbackend.ReservedTopology{}
+	duts, err := assignDevices("DUT", inv.GetDuts(), tb.GetDuts(), pins)
+	if err != nil {
+		return nil, err
+	}
+	for _, dut := range tb.GetDuts() {
+		dev, err := reservedDevice(duts[dut.GetId()], dut, pins)
+		if err != nil {
+			return nil, err
+		}
+		r.DUTs = append(r.DUTs, &bindingbackend.DUTDevice{
+			Device: dev,
+			GRPC:   grpcServices(duts[dut.GetId()], defaultGRPCPorts),
+		})
+	}
+
+	ates, err := assignDevices("ATE", inv.GetAtes(), tb.GetAtes(), pins)
+	if err != nil {
+		return nil, err
+	}
+	for _, ate := range tb.GetAtes() {
+		dev, err := reservedDevice(ates[ate.GetId()], ate, pins)
+		if err != nil {
+			return nil, err
+		}
+		r.ATEs = append(r.ATEs, &bindingbackend.ATEDevice{
+			Device: dev,
+			GRPC:   grpcServices(ates[ate.GetId()], defaultATEGRPCPorts),
+		})
+	}
+	return r, nil
+}
+
+// assignDevices assigns an inventory device to every wanted testbed device of
+// the given kind.
+func assignDevices(kind string, inv []*inpb.Device, want []*opb.Device, pins *partialMapping) (map[string]*inpb.Device, error) {
+	used := map[*inpb.Device]bool{}
+	assigned := map[string]*inpb.Device{}
+
+	fits := func(dev *inpb.Device, tbDev *opb.Device) bool {
+		return !used[dev] && len(dev.GetPorts()) >= len(tbDev.GetPorts()) && hasPorts(dev, pins.ports[tbDev.GetId()])
+	}
+
+	// Pinned devices are mandatory.
+	for _, tbDev := range want {
+		name, ok := pins.devices[tbDev.GetId()]
+		if !ok {
+			continue
+		}
+		var dev *inpb.Device
+		for _, d := range inv {
+			if d.GetName() == name {
+				dev = d
+				break
+			}
+		}
+		switch {
+		case dev == nil:
+			return nil, fmt.Errorf("partial mapping %s=%s: no such %s in inventory", tbDev.GetId(), name, kind)
+		case used[dev]:
+			return nil, fmt.Errorf("partial mapping %s=%s: device is already mapped to another testbed %s", tbDev.GetId(), name, kind)
+		case !fits(dev, tbDev):
+			return nil, fmt.Errorf("partial mapping %s=%s: device cannot satisfy testbed %s %q with %d ports and pinned ports %v", tbDev.GetId(), name, kind, tbDev.GetId(), len(tbDev.GetPorts()), pins.ports[tbDev.GetId()])
+		}
+		assigned[tbDev.GetId()] = dev
+		used[dev] = true
+	}
+	// The other devices are assigned by backtracking, so that a device
+	// preferred by one testbed device is given up if another one needs it.
+	// Testbeds have a handful of devices, which keeps the search short.
+	var free []*opb.Device
+	for _, tbDev := range want {
+		if assigned[tbDev.GetId()] == nil {
+			free = append(free, tbDev)
+		}
+	}
+	var assign func(i int) bool
+	assign = func(i int) bool {
+		if i == len(free) {
+			return true
+		}
+		tbDev := free[i]
+		for _, dev := range candidates(inv, tbDev, free) {
+			if !fits(dev, tbDev) {
+				continue
+			}
+			assigned[tbDev.GetId()], used[dev] = dev, true
+			if assign(i + 1) {
+				return true
+			}
+			delete(assigned, tbDev.GetId())
+			delete(used, dev)
+		}
+		return false
+	}
+	if !assign(0) {
+		var ids []string
+		for _, tbDev := range free {
+			fitting := false
+			for _, dev := range inv {
+				fitting = fitting || fits(dev, tbDev)
+			}
+			if !fitting {
+				return nil, fmt.Errorf("inventory cannot satisfy testbed %s %q: no free device with at least %d ports (inventory has %d devices, testbed requests %d %ss)", kind, tbDev.GetId(), len(tbDev.GetPorts()), len(inv), len(want), kind)
+			}
+			ids = append(ids, tbDev.GetId())
+		}
+		return nil, fmt.Errorf("inventory cannot satisfy testbed %ss %v together: not enough free devices with enough ports (inventory has %d devices)", kind, ids, len(inv))
+	}
+	return assigned, nil
+}
+
+// candidates returns the inventory devices in the order they are tried for
+// the testbed device: the devices declaring its testbed ID, then the devices
+// not declaring the ID of another testbed device, then the remaining ones, each
+// in inventory order.
+func candidates(inv []*inpb.Device, tbDev *opb.Device, want []*opb.Device) []*inpb.Device {
+	ids := map[string]bool{}
+	for _, d := range want {
+		ids[d.GetId()] = true
+	}
+	var own, others, preferred []*inpb.Device
+	for _, dev := range inv {
+		switch {
+		case dev.GetId() == tbDev.GetId():
+			own = append(own, dev)
+		case ids[dev.GetId()]:
+			preferred = append(preferred, dev)
+		default:
+			others = append(others, dev)
+		}
+	}
+	return append(append(own, others...), preferred...)
+}
+
+// reservedDevice returns the reserved device for the testbed device.
+func reservedDevice(dev *inpb.Device, tbDev *opb.Device, pins *partialMapping) (*bindingbackend.Device, error) {
+	ports, err := matchPorts(dev, tbDev, pins.ports[tbDev.GetId()])
+	if err != nil {
+		return nil, err
+	}
+	return &bindingbackend.Device{
+		ID:              tbDev.GetId(),
+		Name:            dev.GetName(),
+		PortMap:         ports,
+		Vendor:          opb.Device_Vendor(opb.Device_Vendor_value[dev.GetVendor()]),
+		HardwareModel:   dev.GetHardwareModel(),
+		SoftwareVersion: dev.GetSoftwareVersion(),
+	}, nil
+}
+
+// matchPorts assigns a port of the inventory device to every port requested
+// for the testbed DUT. pinned maps testbed port IDs to the port names they
+// must be reserved as.
+func matchPorts(dev *inpb.Device, dut *opb.Device, pinned map[string]string) (map[string]*binding.Port, error) {
+	used := map[*inpb.Port]bool{}
+	ports := map[string]*binding.Port{}
+
+	for _, want := range dut.GetPorts() {
+		name, ok := pinned[want.GetId()]
+		if !ok {
+			continue
+		}
+		for _, p := range dev.GetPorts() {
+			if p.GetName() != name {
+				continue
+			}
+			if used[p] {
+				return nil, fmt.Errorf("partial mapping %s:%s=%s: port is already mapped to another testbed port", dut.GetId(), want.GetId(), name)
+			}
+			ports[want.GetId()] = &binding.Port{Name: p.GetName()}
+			used[p] = true
+			break
+		}
+		if ports[want.GetId()] == nil {
+			return nil, fmt.Errorf("partial mapping %s:%s=%s: device %q has no such port", dut.GetId(), want.GetId(), name, dev.GetName())
+		}
+	}
+	for _, want := range dut.GetPorts() {
+		if ports[want.GetId()] != nil {
+			continue
+		}
+		for _, p := range dev.GetPorts() {
+			if p.GetId() != "" && p.GetId() == want.GetId() && !used[p] {
+				ports[want.GetId()] = &binding.Port{Name: p.GetName()}
+				used[p] = true
+				break
+			}
+		}
+	}
+	for _, want := range dut.GetPorts() {
+		if ports[want.GetId()] != nil {
+			continue
+		}
+		for _, p := range dev.GetPorts() {
+			if !used[p] {
+				ports[want.GetId()] = &binding.Port{Name: p.GetName()}
+				used[p] = true
+				break
+			}
+		}
+		if ports[want.GetId()] == nil {
+			return nil, fmt.Errorf("inventory device %q cannot satisfy port %s:%s: all %d ports are in use", dev.GetName(), dut.GetId(), want.GetId(), len(dev.GetPorts()))
+		}
+	}
+	return ports, nil
+}
+
+// reservedDevices returns the DUTs and ATEs of the topology.
+func reservedDevices(r *bindingbackend.ReservedTopology) []*bindingbackend.Device {
+	var devs []*bindingbackend.Device
+	for _, dut := range r.DUTs {
+		devs = append(devs, dut.Device)
+	}
+	for _, ate := range r.ATEs {
+		devs = append(devs, ate.Device)
+	}
+	return devs
+}
+
+// topologyLinks returns the inventory links between the reserved ports. If
+// the inventory has no links, the devices are assumed to be cabled as the
+// testbed links.
+func topologyLinks(inv *inpb.Inventory, tb *opb.Testbed, r *bindingbackend.ReservedTopology) ([]*bindingbackend.Link, error) {
+	if len(inv.GetLinks()) == 0 {
+		return bindingbackend.TestbedLinks(tb)
+	}
+
+	type port struct{ device, name string }
+	reserved := map[port]bindingbackend.LinkEnd{}
+	for _, dev := range reservedDevices(r) {
+		for id, p := range dev.PortMap {
+			reserved[port{dev.Name, p.Name}] = bindingbackend.LinkEnd{Device: dev.ID, Port: id}
+		}
+	}
+	var links []*bindingbackend.Link
+	cabled := map[bindingbackend.Link]bool{}
+	for _, l := range inv.GetLinks() {
+		a, okA := reserved[port{l.GetA().GetDevice(), l.GetA().GetPort()}]
+		b, okB := reserved[port{l.GetB().GetDevice(), l.GetB().GetPort()}]
+		if !okA || !okB {
+			continue
+		}
+		links = append(links, &bindingbackend.Link{A: a, B: b})
+		cabled[bindingbackend.Link{A: a, B: b}] = true
+		cabled[bindingbackend.Link{A: b, B: a}] = true
+	}
+
+	want, err := bindingbackend.TestbedLinks(tb)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range want {
+		if !cabled[*l] {
+			log.Warningf("Testbed link %s:%s <-> %s:%s is not cabled in the reserved topology", l.A.Device, l.A.Port, l.B.Device, l.B.Port)
+		}
+	}
+	return links, nil
+}
+
+// grpcServices returns the gRPC service addresses and proxies of the
+// inventory device for the services of the given default ports.
+func grpcServices(dev *inpb.Device, defaultPorts map[bindingbackend.GRPCService]string) bindingbackend.GRPCServices {
+	host := dev.GetAddress()
+	if host == "" {
+		host = dev.GetName()
+	}
+
+	services := bindingbackend.GRPCServices{
+		Addr:  map[bindingbackend.GRPCService]string{},
+		Proxy: map[bindingbackend.GRPCService][]string{},
+	}
+	for service, port := range defaultPorts {
+		addr := dev.GetGrpcAddrs()[string(service)]
+		switch {
+		case addr == "":
+			addr = net.JoinHostPort(host, port)
+		case strings.HasPrefix(addr, ":"):
+			addr = net.JoinHostPort(host, addr[1:])
+		}
+		services.Addr[service] = addr
+
+		proxies, ok := dev.GetProxies()[string(service)]
+		if !ok {
+			proxies = dev.GetProxies()["*"]
+		}
+		if len(proxies.GetAddrs()) > 0 {
+			services.Proxy[service] = proxies.GetAddrs()
+		}
+	}
+	return services
+}
@@ -0,0 +1,396 @@
+package pinsbackend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	opb "github.com/openconfig/ondatra/proto"
+	inpb "github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/proto/inventory"
+)
+
+// device returns an inventory device with the given number of ports named
+// Ethernet1/<n>/1 and without port IDs.
+func device(id, name string, ports int) *inpb.Device {
+	d := &inpb.Device{Id: id, Name: name}
+	for i := 1; i <= ports; i++ {
+		d.Ports = append(d.Ports, &inpb.Port{Name: fmt.Sprintf("Ethernet1/%d/1", i)})
+	}
+	return d
+}
+
+// testbedDevice returns a testbed device with the ports port1 to port<n>.
+func testbedDevice(id string, ports int) *opb.Device {
+	d := &opb.Device{Id: id}
+	for i := 1; i <= ports; i++ {
+		d.Ports = append(d.Ports, &opb.Port{Id: fmt.Sprintf("port%d", i)})
+	}
+	return d
+}
+
+// assignment returns the device name of every testbed device and the port name
+// of every testbed port, e.g. "DUT:port1", of the topology.
+func assignment(r *bindingbackend.ReservedTopology) map[string]string {
+	got := map[string]string{}
+	for _, dev := range reservedDevices(r) {
+		got[dev.ID] = dev.Name
+		for id, p := range dev.PortMap {
+			got[dev.ID+":"+id] = p.Name
+		}
+	}
+	return got
+}
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoadInventory(t *testing.T) {
+	want := &inpb.Inventory{
+		Duts: []*inpb.Device{{
+			Id:        "DUT",
+			Name:      "sw1",
+			Address:   "10.0.0.1",
+			GrpcAddrs: map[string]string{"gnmi": ":9339"},
+			Ports:     []*inpb.Port{{Id: "port1", Name: "Ethernet1/1/1"}, {Name: "Ethernet1/2/1"}},
+			Vendor:    "ARISTA",
+		}},
+		Ates: []*inpb.Device{{Name: "ate1", Ports: []*inpb.Port{{Name: "1/1"}}}},
+		Links: []*inpb.Link{{
+			A: &inpb.LinkEnd{Device: "sw1", Port: "Ethernet1/1/1"},
+			B: &inpb.LinkEnd{Device: "ate1", Port: "1/1"},
+		}},
+	}
+	tests := []struct {
+		desc, file, contents string
+	}{{
+		desc: "textproto",
+		file: "inventory.textproto",
+		contents: `
+duts {
+  id: "DUT"
+  name: "sw1"
+  address: "10.0.0.1"
+  grpc_addrs { key: "gnmi" value: ":9339" }
+  ports { id: "port1" name: "Ethernet1/1/1" }
+  ports { name: "Ethernet1/2/1" }
+  vendor: "ARISTA"
+}
+ates {
+  name: "ate1"
+  ports { name: "1/1" }
+}
+links {
+  a { device: "sw1" port: "Ethernet1/1/1" }
+  b { device: "ate1" port: "1/1" }
+}
+`,
+	}, {
+		desc: "YAML",
+		file: "inventory.yaml",
+		contents: `
+duts:
+- id: DUT
+  name: sw1
+  address: 10.0.0.1
+  grpc_addrs: {gnmi: ":9339"}
+  ports:
+  - {id: port1, name: Ethernet1/1/1}
+  - {name: Ethernet1/2/1}
+  vendor: ARISTA
+ates:
+- name: ate1
+  ports: [{name: 1/1}]
+links:
+- a: {device: sw1, port: Ethernet1/1/1}
+  b: {device: ate1, port: 1/1}
+`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := LoadInventory(writeFile(t, tt.file, tt.contents))
+			if err != nil {
+				t.Fatalf("LoadInventory() failed: %v", err)
+			}
+			if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("LoadInventory() differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadInventoryErrors(t *testing.T) {
+	tests := []struct {
+		desc, file, contents, wantErr string
+	}{{
+		desc:     "invalid textproto",
+		file:     "inventory.textproto",
+		contents: `duts {`,
+		wantErr:  "failed to parse textproto inventory",
+	}, {
+		desc:     "invalid YAML",
+		file:     "inventory.yml",
+		contents: "duts: [{name: sw1, unknown: 1}]",
+		wantErr:  "failed to parse YAML inventory",
+	}, {
+		desc:     "no DUTs",
+		file:     "inventory.textproto",
+		contents: `ates { name: "ate1" }`,
+		wantErr:  "no DUTs defined",
+	}, {
+		desc:     "device without name",
+		file:     "inventory.textproto",
+		contents: `duts { id: "DUT" }`,
+		wantErr:  `device "DUT" has no name`,
+	}, {
+		desc:     "duplicate device",
+		file:     "inventory.textproto",
+		contents: `duts { name: "sw1" } ates { name: "sw1" }`,
+		wantErr:  `device "sw1" defined more than once`,
+	}, {
+		desc:     "unknown vendor",
+		file:     "inventory.textproto",
+		contents: `duts { name: "sw1" vendor: "ACME" }`,
+		wantErr:  `unknown vendor "ACME"`,
+	}, {
+		desc:     "port without name",
+		file:     "inventory.textproto",
+		contents: `duts { name: "sw1" ports { id: "port1" } }`,
+		wantErr:  `device "sw1" has a port without name`,
+	}, {
+		desc:     "duplicate port",
+		file:     "inventory.textproto",
+		contents: `duts { name: "sw1" ports { name: "Ethernet1/1/1" } ports { name: "Ethernet1/1/1" } }`,
+		wantErr:  `port "Ethernet1/1/1" defined more than once`,
+	}, {
+		desc:     "link to unknown port",
+		file:     "inventory.textproto",
+		contents: `duts { name: "sw1" ports { name: "Ethernet1/1/1" } } links { a { device: "sw1" port: "Ethernet1/1/1" } b { device: "sw2" port: "Ethernet1/1/1" } }`,
+		wantErr:  "link end sw2:Ethernet1/1/1 is not a port of the inventory",
+	}, {
+		desc: "port cabled twice",
+		file: "inventory.textproto",
+		contents: `duts { name: "sw1" ports { name: "Ethernet1/1/1" } ports { name: "Ethernet1/2/1" } ports { name: "Ethernet1/3/1" } }
+links { a { device: "sw1" port: "Ethernet1/1/1" } b { device: "sw1" port: "Ethernet1/2/1" } }
+links { a { device: "sw1" port: "Ethernet1/1/1" } b { device: "sw1" port: "Ethernet1/3/1" } }`,
+		wantErr: "port sw1:Ethernet1/1/1 is part of more than one link",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := LoadInventory(writeFile(t, tt.file, tt.contents))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadInventory() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchTestbed(t *testing.T) {
+	portIDs := device("", "sw-ids", 3)
+	portIDs.Ports[2].Id = "port1"
+
+	tests := []struct {
+		desc string
+		duts []*inpb.Device
+		tb   []*opb.Device
+		want map[string]string
+	}{{
+		desc: "inventory order",
+		duts: []*inpb.Device{device("", "sw1", 2), device("", "sw2", 2)},
+		tb:   []*opb.Device{testbedDevice("DUT", 2)},
+		want: map[string]string{"DUT": "sw1", "DUT:port1": "Ethernet1/1/1", "DUT:port2": "Ethernet1/2/1"},
+	}, {
+		desc: "device with too few ports is skipped",
+		duts: []*inpb.Device{device("", "sw1", 1), device("", "sw2", 2)},
+		tb:   []*opb.Device{testbedDevice("DUT", 2)},
+		want: map[string]string{"DUT": "sw2", "DUT:port1": "Ethernet1/1/1", "DUT:port2": "Ethernet1/2/1"},
+	}, {
+		desc: "device with the testbed ID is preferred",
+		duts: []*inpb.Device{device("", "sw1", 1), device("DUT", "sw2", 1)},
+		tb:   []*opb.Device{testbedDevice("DUT", 1)},
+		want: map[string]string{"DUT": "sw2", "DUT:port1": "Ethernet1/1/1"},
+	}, {
+		desc: "device preferred by another testbed device is taken last",
+		duts: []*inpb.Device{device("DUT2", "sw1", 1), device("", "sw2", 1)},
+		tb:   []*opb.Device{testbedDevice("DUT", 1), testbedDevice("DUT2", 1)},
+		want: map[string]string{"DUT": "sw2", "DUT:port1": "Ethernet1/1/1", "DUT2": "sw1", "DUT2:port1": "Ethernet1/1/1"},
+	}, {
+		// A greedy match gives sw1 to DUT and has no device left for DUT2.
+		desc: "preferred device is given up for a testbed device needing it",
+		duts: []*inpb.Device{device("DUT", "sw1", 2), device("", "sw2", 1)},
+		tb:   []*opb.Device{testbedDevice("DUT", 1), testbedDevice("DUT2", 2)},
+		want: map[string]string{"DUT": "sw2", "DUT:port1": "Ethernet1/1/1", "DUT2": "sw1", "DUT2:port1": "Ethernet1/1/1", "DUT2:port2": "Ethernet1/2/1"},
+	}, {
+		desc: "port with the testbed ID is preferred",
+		duts: []*inpb.Device{portIDs},
+		tb:   []*opb.Device{testbedDevice("DUT", 2)},
+		want: map[string]string{"DUT": "sw-ids", "DUT:port1": "Ethernet1/3/1", "DUT:port2": "Ethernet1/1/1"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			r, err := matchTestbed(&inpb.Inventory{Duts: tt.duts}, &opb.Testbed{Duts: tt.tb}, nil)
+			if err != nil {
+				t.Fatalf("matchTestbed() failed: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, assignment(r)); diff != "" {
+				t.Errorf("matchTestbed() assignment differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMatchTestbedErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		duts    []*inpb.Device
+		tb      []*opb.Device
+		wantErr string
+	}{{
+		desc:    "not enough ports",
+		duts:    []*inpb.Device{device("", "sw1", 1)},
+		tb:      []*opb.Device{testbedDevice("DUT", 2)},
+		wantErr: `testbed DUT "DUT": no free device with at least 2 ports`,
+	}, {
+		desc:    "not enough devices",
+		duts:    []*inpb.Device{device("", "sw1", 2)},
+		tb:      []*opb.Device{testbedDevice("DUT", 1), testbedDevice("DUT2", 1)},
+		wantErr: "testbed DUTs [DUT DUT2] together",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := matchTestbed(&inpb.Inventory{Duts: tt.duts}, &opb.Testbed{Duts: tt.tb}, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("matchTestbed() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchTestbedPartial(t *testing.T) {
+	duts := []*inpb.Device{device("", "sw1", 2), device("", "sw2", 3)}
+	tests := []struct {
+		desc    string
+		tb      []*opb.Device
+		partial map[string]string
+		want    map[string]string
+	}{{
+		desc:    "pinned device",
+		tb:      []*opb.Device{testbedDevice("DUT", 1)},
+		partial: map[string]string{"DUT": "sw2"},
+		want:    map[string]string{"DUT": "sw2", "DUT:port1": "Ethernet1/1/1"},
+	}, {
+		desc:    "pinned device is not assigned to another testbed device",
+		tb:      []*opb.Device{testbedDevice("DUT", 1), testbedDevice("DUT2", 1)},
+		partial: map[string]string{"DUT2": "sw1"},
+		want:    map[string]string{"DUT": "sw2", "DUT:port1": "Ethernet1/1/1", "DUT2": "sw1", "DUT2:port1": "Ethernet1/1/1"},
+	}, {
+		desc:    "pinned port",
+		tb:      []*opb.Device{testbedDevice("DUT", 2)},
+		partial: map[string]string{"DUT:port1": "Ethernet1/2/1"},
+		want:    map[string]string{"DUT": "sw1", "DUT:port1": "Ethernet1/2/1", "DUT:port2": "Ethernet1/1/1"},
+	}, {
+		desc:    "pinned port selects the device",
+		tb:      []*opb.Device{testbedDevice("DUT", 1)},
+		partial: map[string]string{"DUT:port1": "Ethernet1/3/1"},
+		want:    map[string]string{"DUT": "sw2", "DUT:port1": "Ethernet1/3/1"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			r, err := matchTestbed(&inpb.Inventory{Duts: duts}, &opb.Testbed{Duts: tt.tb}, tt.partial)
+			if err != nil {
+				t.Fatalf("matchTestbed() failed: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, assignment(r)); diff != "" {
+				t.Errorf("matchTestbed() assignment differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMatchTestbedPartialErrors(t *testing.T) {
+	duts := []*inpb.Device{device("", "sw1", 1), device("", "sw2", 2)}
+	tb := []*opb.Device{testbedDevice("DUT", 2), testbedDevice("DUT2", 1)}
+	tests := []struct {
+		desc    string
+		partial map[string]string
+		wantErr string
+	}{{
+		desc:    "unknown testbed device",
+		partial: map[string]string{"DUT3": "sw1"},
+		wantErr: `testbed has no device "DUT3"`,
+	}, {
+		desc:    "unknown testbed port",
+		partial: map[string]string{"DUT:port9": "Ethernet1/1/1"},
+		wantErr: `testbed device "DUT" has no port "port9"`,
+	}, {
+		desc:    "device not in inventory",
+		partial: map[string]string{"DUT": "sw9"},
+		wantErr: "partial mapping DUT=sw9: no such DUT in inventory",
+	}, {
+		desc:    "device with too few ports",
+		partial: map[string]string{"DUT": "sw1"},
+		wantErr: `partial mapping DUT=sw1: device cannot satisfy testbed DUT "DUT" with 2 ports`,
+	}, {
+		desc:    "device pinned twice",
+		partial: map[string]string{"DUT": "sw2", "DUT2": "sw2"},
+		wantErr: "device is already mapped to another testbed DUT",
+	}, {
+		desc:    "port pinned twice",
+		partial: map[string]string{"DUT:port1": "Ethernet1/1/1", "DUT:port2": "Ethernet1/1/1"},
+		wantErr: "partial mapping DUT:port2=Ethernet1/1/1: port is already mapped to another testbed port",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := matchTestbed(&inpb.Inventory{Duts: duts}, &opb.Testbed{Duts: tb}, tt.partial)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("matchTestbed() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGRPCServices(t *testing.T) {
+	dev := &inpb.Device{
+		Name:      "sw1",
+		Address:   "10.0.0.1",
+		GrpcAddrs: map[string]string{"gnmi": ":9999", "p4rt": "p4rt.lab:9559"},
+		Proxies:   map[string]*inpb.Proxies{"*": {Addrs: []string{"proxy:1"}}, "p4rt": {Addrs: []string{"proxy:2"}}},
+	}
+	got := grpcServices(dev, defaultGRPCPorts)
+	want := bindingbackend.GRPCServices{
+		Addr: map[bindingbackend.GRPCService]string{
+			bindingbackend.GNMI:  "10.0.0.1:9999",
+			bindingbackend.GNOI:  "10.0.0.1:9339",
+			bindingbackend.GNSI:  "10.0.0.1:9339",
+			bindingbackend.GRIBI: "10.0.0.1:9340",
+			bindingbackend.P4RT:  "p4rt.lab:9559",
+		},
+		Proxy: map[bindingbackend.GRPCService][]string{
+			bindingbackend.GNMI:  {"proxy:1"},
+			bindingbackend.GNOI:  {"proxy:1"},
+			bindingbackend.GNSI:  {"proxy:1"},
+			bindingbackend.GRIBI: {"proxy:1"},
+			bindingbackend.P4RT:  {"proxy:2"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("grpcServices() differs (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,341 @@
+package pinsbackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+var (
+	leaseDir = flag.String("lease_dir", filepath.Join(os.TempDir(), "pins_leases"), "directory holding the leases of the reserved devices; share it between all users of the testbed to get exclusive reservations.")
+	leaseTTL = flag.Duration("lease_ttl", 2*time.Minute, "time after which the lease of a device expires unless it is renewed by the test holding it.")
+)
+
+// leasePollInterval is how often busy devices are checked while waiting for a
+// reservation.
+const leasePollInterval = 5 * time.Second
+
+// minLeaseTTL is the minimum --lease_ttl, leases are renewed every third of it.
+const minLeaseTTL = 3 * time.Second
+
+// errLeaseChanged reports a lease renewed or taken over while it was broken.
+var errLeaseChanged = errors.New("lease changed while breaking it")
+
+// lease is the content of the lease file of a device. A device is leased
+// while its lease file exists and has not expired.
+type lease struct {
+	Reservation string    `json:"reservation"`
+	Owner       string    `json:"owner"`
+	Expires     time.Time `json:"expires"`
+	// Deadline is the end of the runtime of the reservation, the lease is not
+	// renewed past it. It is zero if the runtime is not limited.
+	Deadline time.Time `json:"deadline,omitempty"`
+}
+
+func (l *lease) expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
+
+func (l *lease) equal(o *lease) bool {
+	return l.Reservation == o.Reservation && l.Owner == o.Owner && l.Expires.Equal(o.Expires) && l.Deadline.Equal(o.Deadline)
+}
+
+// busyError reports a device leased by another reservation.
+type busyError struct {
+	device string
+	lease  *lease
+}
+
+func (e *busyError) Error() string {
+	return fmt.Sprintf("device %s is leased by reservation %s of %s until %s", e.device, e.lease.Reservation, e.lease.Owner, e.lease.Expires.Format(time.RFC3339))
+}
+
+// leaseOwner identifies the process holding a lease.
+func leaseOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s:%d", os.Getenv("USER"), host, os.Getpid())
+}
+
+// leaseFile returns the path of the lease file of the device.
+func leaseFile(device string) (string, error) {
+	if device == "" || filepath.Base(device) != device {
+		return "", fmt.Errorf("invalid device name %q", device)
+	}
+	return filepath.Join(*leaseDir, device+".lease"), nil
+}
+
+func readLease(path string) (*lease, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &lease{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("failed to parse lease %s: %v", path, err)
+	}
+	return l, nil
+}
+
+// writeLease atomically replaces the lease file.
+func writeLease(path string, l *lease) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// createLease creates the lease file, failing if it already exists.
+func createLease(path string, l *lease) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// breakLease removes the expired lease. The lease file is renamed to a
+// tombstone unique to the caller, so a single process breaks it. If the
+// tombstone is not the expired lease, the lease was renewed or taken over in
+// the meantime and it is put back.
+func breakLease(path string, expired *lease) error {
+	tomb := fmt.Sprintf("%s.broken.%d.%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, tomb); err != nil {
+		return err
+	}
+	defer os.Remove(tomb)
+	if got, err := readLease(tomb); err == nil && got.equal(expired) {
+		return nil
+	}
+	if err := os.Link(tomb, path); err != nil {
+		log.Warningf("Failed to restore lease %s: %v", path, err)
+	}
+	return errLeaseChanged
+}
+
+// tryLease leases the device to the reservation. Leases of the same
+// reservation are taken over and expired leases are broken. It returns a
+// busyError if the device is leased by another reservation.
+func tryLease(device string, l *lease) error {
+	path, err := leaseFile(device)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*leaseDir, 0755); err != nil {
+		return fmt.Errorf("failed to create lease directory: %v", err)
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err := createLease(path, l)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to lease device %s: %v", device, err)
+		}
+		cur, err := readLease(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // released in the meantime
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case cur.Reservation == l.Reservation:
+			return writeLease(path, l)
+		case cur.expired(time.Now()):
+			log.Warningf("Breaking expired lease of device %s held by reservation %s of %s", device, cur.Reservation, cur.Owner)
+			if err := breakLease(path, cur); err != nil && !os.IsNotExist(err) && !errors.Is(err, errLeaseChanged) {
+				return fmt.Errorf("failed to break expired lease of device %s: %v", device, err)
+			}
+		default:
+			return &busyError{device: device, lease: cur}
+		}
+	}
+	return fmt.Errorf("failed to lease device %s: lease file keeps changing", device)
+}
+
+// isLeased returns whether the device is leased by another reservation.
+func isLeased(device, id string) bool {
+	path, err := leaseFile(device)
+	if err != nil {
+		return false
+	}
+	l, err := readLease(path)
+	if err != nil {
+		return false
+	}
+	return l.Reservation != id && !l.expired(time.Now())
+}
+
+// leases holds the leases of the devices of a reservation and renews them in
+// the background until the runtime of the reservation is over.
+type leases struct {
+	id       string
+	devices  []string
+	deadline time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newLease returns the lease of the reservation expiring after --lease_ttl or
+// at the deadline, whichever comes first.
+func newLease(id string, deadline time.Time) *lease {
+	l := &lease{
+		Reservation: id,
+		Owner:       leaseOwner(),
+		Expires:     time.Now().Add(*leaseTTL),
+		Deadline:    deadline,
+	}
+	if !deadline.IsZero() && deadline.Before(l.Expires) {
+		l.Expires = deadline
+	}
+	return l
+}
+
+// leaseDeadline returns the runtime deadline recorded in the leases of the
+// reservation, if any.
+func leaseDeadline(id string, devices []string) time.Time {
+	for _, device := range devices {
+		path, err := leaseFile(device)
+		if err != nil {
+			continue
+		}
+		if l, err := readLease(path); err == nil && l.Reservation == id {
+			return l.Deadline
+		}
+	}
+	return time.Time{}
+}
+
+// acquireLeases leases all devices to the reservation or none of them.
+func acquireLeases(id string, devices []string, deadline time.Time) (*leases, error) {
+	if *leaseTTL < minLeaseTTL {
+		return nil, fmt.Errorf("--lease_ttl must be at least %v, got %v", minLeaseTTL, *leaseTTL)
+	}
+	sorted := append([]string(nil), devices...)
+	sort.Strings(sorted)
+	l := newLease(id, deadline)
+	var acquired []string
+	for _, device := range sorted {
+		if err := tryLease(device, l); err != nil {
+			freeLeases(id, acquired)
+			return nil, err
+		}
+		acquired = append(acquired, device)
+	}
+	ls := &leases{
+		id:       id,
+		devices:  sorted,
+		deadline: deadline,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go ls.renew()
+	log.Infof("Leased devices %s to reservation %s until %s", strings.Join(sorted, ", "), id, l.Expires.Format(time.RFC3339))
+	return ls, nil
+}
+
+// renew extends the leases every third of --lease_ttl until the deadline.
+func (ls *leases) renew() {
+	defer close(ls.done)
+	ticker := time.NewTicker(*leaseTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ls.stop:
+			return
+		case <-ticker.C:
+		}
+		if !ls.deadline.IsZero() && !time.Now().Before(ls.deadline) {
+			log.Warningf("Runtime of reservation %s is over, its leases are no longer renewed", ls.id)
+			return
+		}
+		l := newLease(ls.id, ls.deadline)
+		for _, device := range ls.devices {
+			if err := tryLease(device, l); err != nil {
+				log.Errorf("Failed to renew lease of reservation %s: %v", ls.id, err)
+			}
+		}
+	}
+}
+
+// stopRenewal stops renewing the leases, they expire after --lease_ttl.
+func (ls *leases) stopRenewal() {
+	ls.stopOnce.Do(func() { close(ls.stop) })
+	<-ls.done
+}
+
+// release stops renewing the leases and frees the devices.
+func (ls *leases) release() error {
+	ls.stopRenewal()
+	return freeLeases(ls.id, ls.devices)
+}
+
+// freeLeases removes the leases of the devices still held by the reservation.
+func freeLeases(id string, devices []string) error {
+	var err error
+	for _, device := range devices {
+		path, e := leaseFile(device)
+		if e != nil {
+			continue
+		}
+		if l, e := readLease(path); e != nil || l.Reservation != id {
+			continue
+		}
+		if e := os.Remove(path); e != nil && !os.IsNotExist(e) && err == nil {
+			err = fmt.Errorf("failed to free lease of device %s: %v", device, e)
+		}
+	}
+	return err
+}
+
+// waitForLeases calls reserve until it succeeds, it fails with a busyError, or
+// the wait time is over.
+func waitForLeases(ctx context.Context, waitTime time.Duration, reserve func() error) error {
+	end := time.Now().Add(waitTime)
+	for {
+		err := reserve()
+		var busy *busyError
+		if !errors.As(err, &busy) {
+			return err
+		}
+		wait := time.Until(end)
+		if wait <= 0 {
+			return fmt.Errorf("testbed is still busy after waiting %v: %v", waitTime, err)
+		}
+		if wait > leasePollInterval {
+			wait = leasePollInterval
+		}
+		log.Infof("Waiting for busy testbed: %v", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for busy testbed: %v", ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
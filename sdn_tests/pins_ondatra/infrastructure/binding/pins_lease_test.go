@@ -0,0 +1,224 @@
+package pinsbackend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setLeaseFlags points --lease_dir to a new directory and sets --lease_ttl for
+// the test.
+func setLeaseFlags(t *testing.T, ttl time.Duration) {
+	t.Helper()
+	dir, oldTTL := *leaseDir, *leaseTTL
+	*leaseDir, *leaseTTL = t.TempDir(), ttl
+	t.Cleanup(func() { *leaseDir, *leaseTTL = dir, oldTTL })
+}
+
+func mustLeaseFile(t *testing.T, device string) string {
+	t.Helper()
+	path, err := leaseFile(device)
+	if err != nil {
+		t.Fatalf("leaseFile(%s) failed: %v", device, err)
+	}
+	return path
+}
+
+func mustReadLease(t *testing.T, device string) *lease {
+	t.Helper()
+	l, err := readLease(mustLeaseFile(t, device))
+	if err != nil {
+		t.Fatalf("Failed to read lease of %s: %v", device, err)
+	}
+	return l
+}
+
+// checkNoTombstones fails the test if broken leases were left behind.
+func checkNoTombstones(t *testing.T) {
+	t.Helper()
+	tombs, err := filepath.Glob(filepath.Join(*leaseDir, "*.broken.*"))
+	if err != nil {
+		t.Fatalf("Failed to list tombstones: %v", err)
+	}
+	if len(tombs) > 0 {
+		t.Errorf("Tombstones left in the lease directory: %v", tombs)
+	}
+}
+
+func TestCreateLease(t *testing.T) {
+	setLeaseFlags(t, time.Minute)
+	path := mustLeaseFile(t, "sw1")
+	first := newLease("res1", time.Time{})
+	if err := createLease(path, first); err != nil {
+		t.Fatalf("createLease() failed: %v", err)
+	}
+	if err := createLease(path, newLease("res2", time.Time{})); !errors.Is(err, os.ErrExist) {
+		t.Errorf("createLease() of a leased device = %v, want %v", err, os.ErrExist)
+	}
+	if got := mustReadLease(t, "sw1"); !got.equal(first) {
+		t.Errorf("Lease is %+v after a failed create, want %+v", got, first)
+	}
+}
+
+func TestTryLease(t *testing.T) {
+	setLeaseFlags(t, time.Minute)
+	if err := tryLease("sw1", newLease("res1", time.Time{})); err != nil {
+		t.Fatalf("tryLease() failed: %v", err)
+	}
+
+	var busy *busyError
+	if err := tryLease("sw1", newLease("res2", time.Time{})); !errors.As(err, &busy) {
+		t.Errorf("tryLease() of a device leased by another reservation = %v, want a busyError", err)
+	}
+	if !isLeased("sw1", "res2") || isLeased("sw1", "res1") {
+		t.Errorf("isLeased() = %v for res2 and %v for res1, want true and false", isLeased("sw1", "res2"), isLeased("sw1", "res1"))
+	}
+
+	// The same reservation takes the lease over, e.g. from --reserve.
+	takeover := newLease("res1", time.Now().Add(time.Hour))
+	takeover.Owner = "other@host:1"
+	if err := tryLease("sw1", takeover); err != nil {
+		t.Fatalf("tryLease() of the same reservation failed: %v", err)
+	}
+	if got := mustReadLease(t, "sw1"); !got.equal(takeover) {
+		t.Errorf("Lease is %+v after the takeover, want %+v", got, takeover)
+	}
+}
+
+func TestTryLeaseBreaksExpiredLease(t *testing.T) {
+	setLeaseFlags(t, time.Minute)
+	expired := &lease{Reservation: "res1", Owner: "other@host:1", Expires: time.Now().Add(-time.Second)}
+	if err := createLease(mustLeaseFile(t, "sw1"), expired); err != nil {
+		t.Fatalf("createLease() failed: %v", err)
+	}
+	l := newLease("res2", time.Time{})
+	if err := tryLease("sw1", l); err != nil {
+		t.Fatalf("tryLease() of an expired lease failed: %v", err)
+	}
+	if got := mustReadLease(t, "sw1"); !got.equal(l) {
+		t.Errorf("Lease is %+v after breaking the expired lease, want %+v", got, l)
+	}
+	checkNoTombstones(t)
+}
+
+func TestBreakLease(t *testing.T) {
+	setLeaseFlags(t, time.Minute)
+	path := mustLeaseFile(t, "sw1")
+	expired := &lease{Reservation: "res1", Owner: "other@host:1", Expires: time.Now().Add(-time.Second)}
+	renewed := &lease{Reservation: "res1", Owner: "other@host:1", Expires: time.Now().Add(time.Minute)}
+	if err := createLease(path, renewed); err != nil {
+		t.Fatalf("createLease() failed: %v", err)
+	}
+
+	// The lease was renewed after it was read as expired, so it is put back.
+	if err := breakLease(path, expired); !errors.Is(err, errLeaseChanged) {
+		t.Errorf("breakLease() of a renewed lease = %v, want %v", err, errLeaseChanged)
+	}
+	if got := mustReadLease(t, "sw1"); !got.equal(renewed) {
+		t.Errorf("Lease is %+v after breaking a renewed lease, want %+v", got, renewed)
+	}
+	checkNoTombstones(t)
+
+	if err := breakLease(path, renewed); err != nil {
+		t.Errorf("breakLease() failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Lease file still exists after breaking it: %v", err)
+	}
+	checkNoTombstones(t)
+
+	// Another process broke the lease first.
+	if err := breakLease(path, renewed); !os.IsNotExist(err) {
+		t.Errorf("breakLease() of a broken lease = %v, want a not exist error", err)
+	}
+}
+
+func TestAcquireLeases(t *testing.T) {
+	setLeaseFlags(t, time.Minute)
+	if err := tryLease("sw2", newLease("res2", time.Time{})); err != nil {
+		t.Fatalf("tryLease() failed: %v", err)
+	}
+
+	var busy *busyError
+	if _, err := acquireLeases("res1", []string{"sw1", "sw2"}, time.Time{}); !errors.As(err, &busy) {
+		t.Fatalf("acquireLeases() of a busy device = %v, want a busyError", err)
+	}
+	if _, err := os.Stat(mustLeaseFile(t, "sw1")); !os.IsNotExist(err) {
+		t.Errorf("Lease of sw1 is kept after failing to lease sw2: %v", err)
+	}
+
+	if err := freeLeases("res2", []string{"sw2"}); err != nil {
+		t.Fatalf("freeLeases() failed: %v", err)
+	}
+	ls, err := acquireLeases("res1", []string{"sw2", "sw1"}, time.Time{})
+	if err != nil {
+		t.Fatalf("acquireLeases() failed: %v", err)
+	}
+	for _, device := range []string{"sw1", "sw2"} {
+		if !isLeased(device, "res2") {
+			t.Errorf("Device %s is not leased to res1", device)
+		}
+	}
+	if err := ls.release(); err != nil {
+		t.Fatalf("release() failed: %v", err)
+	}
+	for _, device := range []string{"sw1", "sw2"} {
+		if isLeased(device, "res2") {
+			t.Errorf("Device %s is still leased after release", device)
+		}
+	}
+}
+
+func TestAcquireLeasesShortTTL(t *testing.T) {
+	setLeaseFlags(t, minLeaseTTL-time.Second)
+	if _, err := acquireLeases("res1", []string{"sw1"}, time.Time{}); err == nil {
+		t.Errorf("acquireLeases() with --lease_ttl=%v succeeded, want error", *leaseTTL)
+	}
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	setLeaseFlags(t, minLeaseTTL)
+	ls, err := acquireLeases("res1", []string{"sw1"}, time.Time{})
+	if err != nil {
+		t.Fatalf("acquireLeases() failed: %v", err)
+	}
+	defer ls.release()
+	first := mustReadLease(t, "sw1")
+
+	time.Sleep(*leaseTTL/3 + time.Second)
+	renewed := mustReadLease(t, "sw1")
+	if !renewed.Expires.After(first.Expires) {
+		t.Errorf("Lease expires at %v after a renewal period, want after %v", renewed.Expires, first.Expires)
+	}
+
+	ls.stopRenewal()
+	stopped := mustReadLease(t, "sw1")
+	time.Sleep(*leaseTTL/3 + time.Second)
+	if got := mustReadLease(t, "sw1"); !got.equal(stopped) {
+		t.Errorf("Lease is %+v after stopping the renewal, want %+v", got, stopped)
+	}
+}
+
+func TestLeaseRenewalStopsAtDeadline(t *testing.T) {
+	setLeaseFlags(t, minLeaseTTL)
+	deadline := time.Now().Add(time.Second)
+	ls, err := acquireLeases("res1", []string{"sw1"}, deadline)
+	if err != nil {
+		t.Fatalf("acquireLeases() failed: %v", err)
+	}
+	defer ls.release()
+	if got := mustReadLease(t, "sw1"); !got.Expires.Equal(deadline) {
+		t.Errorf("Lease expires at %v, want the deadline %v", got.Expires, deadline)
+	}
+
+	select {
+	case <-ls.done:
+	case <-time.After(*leaseTTL):
+		t.Fatalf("Leases are still renewed %v after the deadline", *leaseTTL)
+	}
+	if isLeased("sw1", "res2") {
+		t.Errorf("Device is leased after the deadline")
+	}
+}
@@ -0,0 +1,253 @@
+package pinsbind
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var rpcMetricsEnabled = flag.Bool("grpc_metrics", true, "collect the latency and status codes of the gRPC calls to the devices for every test.")
+
+// latencyBuckets are the upper bounds of the latency histogram buckets. Longer
+// calls fall in a last, unbounded bucket.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// latencyBucket counts the calls that took at most Le, or longer than the
+// previous bucket for the last bucket whose Le is "+Inf".
+type latencyBucket struct {
+	Le    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// methodMetrics are the metrics of the calls of a method of a device. The
+// latency of a stream is the time until it ended.
+type methodMetrics struct {
+	Device  string          `json:"device"`
+	Service string          `json:"service"`
+	Method  string          `json:"method"`
+	Stream  bool            `json:"stream,omitempty"`
+	Count   int             `json:"count"`
+	Codes   map[string]int  `json:"codes"`
+	MinMs   float64         `json:"min_ms"`
+	MaxMs   float64         `json:"max_ms"`
+	MeanMs  float64         `json:"mean_ms"`
+	Buckets []latencyBucket `json:"buckets"`
+
+	total time.Duration
+}
+
+func newMethodMetrics(dut, fullMethod string, stream bool) *methodMetrics {
+	m := &methodMetrics{
+		Device: dut,
+		Method: fullMethod,
+		Stream: stream,
+		Codes:  map[string]int{},
+	}
+	// Full methods look like /gnmi.gNMI/Get.
+	if parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/"); len(parts) == 2 {
+		m.Service, m.Method = parts[0], parts[1]
+	}
+	for _, le := range latencyBuckets {
+		m.Buckets = append(m.Buckets, latencyBucket{Le: le.String()})
+	}
+	m.Buckets = append(m.Buckets, latencyBucket{Le: "+Inf"})
+	return m
+}
+
+func (m *methodMetrics) add(latency time.Duration, err error) {
+	ms := float64(latency) / float64(time.Millisecond)
+	if m.Count == 0 || ms < m.MinMs {
+		m.MinMs = ms
+	}
+	if ms > m.MaxMs {
+		m.MaxMs = ms
+	}
+	m.Count++
+	m.total += latency
+	m.MeanMs = float64(m.total) / float64(time.Millisecond) / float64(m.Count)
+	m.Codes[status.Code(err).String()]++
+
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return latency <= latencyBuckets[i] })
+	m.Buckets[i].Count++
+}
+
+// rpcMetrics collects the metrics of the calls made while a test runs.
+type rpcMetrics struct {
+	test    string
+	methods map[string]*methodMetrics
+}
+
+var (
+	metricsMu sync.Mutex
+	// activeMetrics contains the collections of the running test and of its
+	// parents, so that the metrics of a test include its subtests.
+	activeMetrics []*rpcMetrics
+)
+
+func recordRPC(dut, method string, stream bool, latency time.Duration, err error) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	key := dut + method
+	for _, c := range activeMetrics {
+		m, ok := c.methods[key]
+		if !ok {
+			m = newMethodMetrics(dut, method, stream)
+			c.methods[key] = m
+		}
+		m.add(latency, err)
+	}
+}
+
+// Tests using testhelper.NewTearDownOptions get the metrics of their gRPC calls
+// written to rpc_metrics.json in their output directory.
+func init() {
+	testhelper.RegisterTestHook(func(t *testing.T, dir string) {
+		if dir == "" {
+			log.Warningf("gRPC metrics of %v are not collected without an output directory", t.Name())
+			return
+		}
+		CollectRPCMetrics(t, filepath.Join(dir, "rpc_metrics.json"))
+	})
+}
+
+// CollectRPCMetrics collects the latency histograms and status code counts of
+// the gRPC calls made by the test to the devices, per device and method, and
+// writes them as JSON to the given file when the test completes.
+func CollectRPCMetrics(t testing.TB, path string) {
+	c := &rpcMetrics{test: t.Name(), methods: map[string]*methodMetrics{}}
+	metricsMu.Lock()
+	activeMetrics = append(activeMetrics, c)
+	metricsMu.Unlock()
+
+	t.Cleanup(func() {
+		metricsMu.Lock()
+		for i, active := range activeMetrics {
+			if active == c {
+				activeMetrics = append(activeMetrics[:i], activeMetrics[i+1:]...)
+				break
+			}
+		}
+		metricsMu.Unlock()
+		if err := c.write(path); err != nil {
+			log.Warningf("Failed to write gRPC metrics of %s: %v", c.test, err)
+		}
+	})
+}
+
+func (c *rpcMetrics) write(path string) error {
+	var methods []*methodMetrics
+	for _, m := range c.methods {
+		methods = append(methods, m)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].Device != methods[j].Device {
+			return methods[i].Device < methods[j].Device
+		}
+		if methods[i].Service != methods[j].Service {
+			return methods[i].Service < methods[j].Service
+		}
+		return methods[i].Method < methods[j].Method
+	})
+	data, err := json.MarshalIndent(struct {
+		Test    string           `json:"test"`
+		Methods []*methodMetrics `json:"methods"`
+	}{c.test, methods}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// metricsOpts returns the dial options collecting the metrics of the calls to
+// the device.
+func metricsOpts(dut string) []grpc.DialOption {
+	if !*rpcMetricsEnabled {
+		return nil
+	}
+	unary := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		recordRPC(dut, method, false, time.Since(start), err)
+		return err
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			recordRPC(dut, method, true, time.Since(start), err)
+			return nil, err
+		}
+		ms := &metricsStream{ClientStream: s, dut: dut, method: method, start: start}
+		// Streams the client stops reading are only ended by their context.
+		ms.stop = context.AfterFunc(ctx, func() { ms.record(status.FromContextError(ctx.Err()).Err()) })
+		return ms, nil
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unary),
+		grpc.WithChainStreamInterceptor(stream),
+	}
+}
+
+// metricsStream records the stream once it ended, either by a receive error or
+// by its context.
+type metricsStream struct {
+	grpc.ClientStream
+	dut    string
+	method string
+	start  time.Time
+	once   sync.Once
+	stop   func() bool // stops the recording on context cancellation
+}
+
+func (s *metricsStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.stop()
+		final := err
+		if errors.Is(err, io.EOF) {
+			final = nil
+		}
+		s.record(final)
+	}
+	return err
+}
+
+func (s *metricsStream) record(err error) {
+	s.once.Do(func() {
+		recordRPC(s.dut, s.method, true, time.Since(s.start), err)
+	})
+}
@@ -0,0 +1,104 @@
+package pinsbind
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	spb "github.com/openconfig/gnoi/system"
+	p4pb "github.com/p4lang/p4runtime/go/p4/v1"
+)
+
+// probeTimeout bounds a single readiness probe of a service.
+const probeTimeout = 10 * time.Second
+
+// probeService sends a lightweight request to the service. Services without a
+// cheap RPC are ready once their connection is.
+func probeService(ctx context.Context, conn *grpc.ClientConn, service bindingbackend.GRPCService) error {
+	var err error
+	switch service {
+	case bindingbackend.GNMI:
+		_, err = gpb.NewGNMIClient(conn).Capabilities(ctx, &gpb.CapabilityRequest{})
+	case bindingbackend.GNOI:
+		_, err = spb.NewSystemClient(conn).Time(ctx, &spb.TimeRequest{})
+	case bindingbackend.P4RT:
+		_, err = p4pb.NewP4RuntimeClient(conn).Capabilities(ctx, &p4pb.CapabilitiesRequest{})
+	default:
+		conn.Connect()
+		for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+			if !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("connection is %v: %v", state, ctx.Err())
+			}
+		}
+		return nil
+	}
+	// Any answer of the server, even an error, means that it is serving.
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return err
+	}
+	return nil
+}
+
+// WaitForServices blocks until the given gRPC services of the DUT answer a
+// lightweight probe, e.g. after a reboot, or until the context is done. It
+// waits for all registered services if none is given.
+func (d *pinsDUT) WaitForServices(ctx context.Context, services ...bindingbackend.GRPCService) error {
+	if len(services) == 0 {
+		for service := range d.grpc.Addr {
+			services = append(services, service)
+		}
+		sort.Slice(services, func(i, j int) bool { return services[i] < services[j] })
+	}
+	pending := map[bindingbackend.GRPCService]error{}
+	for _, service := range services {
+		if d.grpc.Addr[service] == "" {
+			return fmt.Errorf("service %s not registered on device %q", service, d.Name())
+		}
+		pending[service] = nil
+	}
+
+	start := time.Now()
+	for retry := 1; ; retry++ {
+		for service := range pending {
+			// The services are probed on their shared connections, dialed
+			// with the default options of the binding.
+			conn, err := d.dial(ctx, service)
+			if err == nil {
+				pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+				err = probeService(pctx, conn, service)
+				cancel()
+			}
+			if err != nil {
+				pending[service] = err
+				continue
+			}
+			delete(pending, service)
+		}
+		if len(pending) == 0 {
+			log.Infof("Services %v of %s are ready after %v", services, d.Name(), time.Since(start).Round(time.Second))
+			return nil
+		}
+
+		var errs []string
+		for service, err := range pending {
+			errs = append(errs, fmt.Sprintf("%s: %v", service, err))
+		}
+		sort.Strings(errs)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("services of %s not ready after %v: %s", d.Name(), time.Since(start).Round(time.Second), strings.Join(errs, "; "))
+		case <-time.After(retryDelay(retry)):
+		}
+	}
+}
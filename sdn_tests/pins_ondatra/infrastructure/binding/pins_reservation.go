@@ -0,0 +1,81 @@
+package pinsbackend
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+)
+
+var (
+	reservationDir  = flag.String("reservation_dir", filepath.Join(os.TempDir(), "pins_reservations"), "directory storing the state of active reservations, used to fetch a reservation by ID from another test binary.")
+	keepReservation = flag.Bool("keep_reservation", false, "keep the reservation state on release so that later test binaries can fetch it with --reserve=<reservation id>.")
+)
+
+// newReservationID returns a unique reservation ID.
+func newReservationID() string {
+	return fmt.Sprintf("pins-%s-%d", time.Now().Format("20060102-150405"), os.Getpid())
+}
+
+// reservationFile returns the path of the state file of the reservation.
+func reservationFile(id string) (string, error) {
+	if id == "" || filepath.Base(id) != id {
+		return "", fmt.Errorf("invalid reservation ID %q", id)
+	}
+	return filepath.Join(*reservationDir, id+".json"), nil
+}
+
+// saveTopology writes the reserved topology to its state file.
+func saveTopology(r *bindingbackend.ReservedTopology) error {
+	path, err := reservationFile(r.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal reservation %s: %v", r.ID, err)
+	}
+	if err := os.MkdirAll(*reservationDir, 0755); err != nil {
+		return fmt.Errorf("failed to create reservation directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save reservation %s: %v", r.ID, err)
+	}
+	return nil
+}
+
+// loadTopology reads the reserved topology from its state file.
+func loadTopology(id string) (*bindingbackend.ReservedTopology, error) {
+	path, err := reservationFile(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reservation %s: %v", id, err)
+	}
+	r := &bindingbackend.ReservedTopology{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse reservation %s: %v", id, err)
+	}
+	if r.ID != id {
+		return nil, fmt.Errorf("reservation file %s contains reservation %q", path, r.ID)
+	}
+	return r, nil
+}
+
+// removeTopology deletes the state file of the reservation.
+func removeTopology(id string) error {
+	path, err := reservationFile(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove reservation %s: %v", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package pinsbind
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ygot/ygot"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// subscription is an open Subscribe stream.
+type subscription struct {
+	id     uint64
+	dut    string
+	tests  []testing.TB // tests that may have opened the stream
+	opened time.Time
+	stack  string // stack of the caller opening the stream
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	mode  gpb.SubscriptionList_Mode
+	paths []string
+}
+
+// close cancels the stream, it is untracked once its context is done.
+func (s *subscription) close() {
+	s.cancel()
+}
+
+func (s *subscription) setRequest(req *gpb.SubscribeRequest) {
+	list := req.GetSubscribe()
+	if list == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = list.GetMode()
+	s.paths = nil
+	for _, sub := range list.GetSubscription() {
+		p, err := ygot.PathToString(joinPaths(list.GetPrefix(), sub.GetPath()))
+		if err != nil {
+			p = sub.GetPath().String()
+		}
+		s.paths = append(s.paths, p)
+	}
+}
+
+func (s *subscription) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%s subscription %d of %s to %s opened %v ago by:\n%s", s.mode, s.id, s.dut, strings.Join(s.paths, ", "), time.Since(s.opened).Round(time.Second), s.stack)
+}
+
+// joinPaths returns the subscribed path including the prefix.
+func joinPaths(prefix, p *gpb.Path) *gpb.Path {
+	if prefix == nil {
+		return p
+	}
+	joined := proto.Clone(prefix).(*gpb.Path)
+	joined.Elem = append(joined.Elem, p.GetElem()...)
+	if p.GetOrigin() != "" {
+		joined.Origin = p.GetOrigin()
+	}
+	return joined
+}
+
+// subscriptions tracks the open Subscribe streams to the DUTs.
+type subscriptions struct {
+	mu    sync.Mutex
+	next  uint64
+	open  map[uint64]*subscription
+	tests map[testing.TB]bool // running tests tracking their streams
+}
+
+var openSubscriptions = &subscriptions{open: map[uint64]*subscription{}, tests: map[testing.TB]bool{}}
+
+// add tracks a new stream until its context is done.
+func (ss *subscriptions) add(ctx context.Context, dut string, cancel context.CancelFunc) *subscription {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.next++
+	s := &subscription{
+		id:     ss.next,
+		dut:    dut,
+		tests:  ss.runningTests(),
+		opened: time.Now(),
+		stack:  string(debug.Stack()),
+		cancel: cancel,
+	}
+	ss.open[s.id] = s
+	go func() {
+		<-ctx.Done()
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+		delete(ss.open, s.id)
+	}()
+	return s
+}
+
+// runningTests returns the tracked tests that may open a stream. A test
+// waiting for its subtests is left out, the stream belongs to a subtest.
+func (ss *subscriptions) runningTests() []testing.TB {
+	var tests []testing.TB
+	for t := range ss.tests {
+		parent := false
+		for other := range ss.tests {
+			if strings.HasPrefix(other.Name(), t.Name()+"/") {
+				parent = true
+				break
+			}
+		}
+		if !parent {
+			tests = append(tests, t)
+		}
+	}
+	return tests
+}
+
+// completed reports whether all the tests that may have opened the stream
+// completed.
+func (ss *subscriptions) completed(s *subscription) bool {
+	if len(s.tests) == 0 {
+		return false
+	}
+	for _, t := range s.tests {
+		if ss.tests[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// closeAll cancels the streams accepted by the filter and returns them in the
+// order they were opened. The filter is called with ss.mu held.
+func (ss *subscriptions) closeAll(filter func(s *subscription) bool) []*subscription {
+	ss.mu.Lock()
+	var leaked []*subscription
+	for _, s := range ss.open {
+		if filter(s) {
+			leaked = append(leaked, s)
+		}
+	}
+	ss.mu.Unlock()
+	sort.Slice(leaked, func(i, j int) bool { return leaked[i].id < leaked[j].id })
+	for _, s := range leaked {
+		s.close()
+	}
+	return leaked
+}
+
+// Tests using testhelper.NewTearDownOptions get their leaked streams reported
+// and cancelled when they complete.
+func init() {
+	testhelper.RegisterTestHook(func(t *testing.T, _ string) {
+		TrackSubscriptions(t)
+	})
+}
+
+// TrackSubscriptions ties the Subscribe streams opened by the test to its
+// lifetime. Streams still open when the test completes are reported as leaked
+// and cancelled. A stream opened while parallel tests run may belong to any of
+// them, it is only cancelled once all of them completed.
+func TrackSubscriptions(t testing.TB) {
+	openSubscriptions.mu.Lock()
+	openSubscriptions.tests[t] = true
+	openSubscriptions.mu.Unlock()
+
+	t.Cleanup(func() {
+		openSubscriptions.mu.Lock()
+		delete(openSubscriptions.tests, t)
+		openSubscriptions.mu.Unlock()
+
+		leaked := openSubscriptions.closeAll(openSubscriptions.completed)
+		for _, s := range leaked {
+			t.Logf("Leaked gNMI %v", s)
+		}
+		if len(leaked) > 0 {
+			log.Warningf("Test %s leaked %d gNMI subscriptions", t.Name(), len(leaked))
+		}
+	})
+}
+
+// closeSubscriptions cancels the streams still open when the reservation is
+// released.
+func closeSubscriptions() {
+	for _, s := range openSubscriptions.closeAll(func(*subscription) bool { return true }) {
+		log.Warningf("Leaked gNMI %v", s)
+	}
+}
+
+// subscribeClientWrap tracks the stream from the moment it is opened until Recv
+// fails, its context is done or the test completes. The stream is closed when
+// Recv fails, including when a response fails to translate.
+type subscribeClientWrap struct {
+	gpb.GNMI_SubscribeClient
+	client *clientWrap
+	sub    *subscription
+}
+
+func (sc *subscribeClientWrap) Send(req *gpb.SubscribeRequest) error {
+	req = proto.Clone(req).(*gpb.SubscribeRequest)
+	if err := translateRequest(sc.client.chain, func(t GNMITranslator) error { return t.SubscribeRequest(req) }); err != nil {
+		return err
+	}
+	sc.sub.setRequest(req)
+	return sc.GNMI_SubscribeClient.Send(req)
+}
+
+func (sc *subscribeClientWrap) Recv() (*gpb.SubscribeResponse, error) {
+	resp, err := sc.GNMI_SubscribeClient.Recv()
+	if err != nil {
+		sc.sub.close()
+		return nil, err
+	}
+	if err := translateResponse(sc.client.chain, func(t GNMITranslator) error { return t.SubscribeResponse(resp) }); err != nil {
+		// Clients stop receiving on errors, which would leave the stream
+		// open.
+		sc.sub.close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CloseSend signals that the client has done sending messages to the server.
+// Half-closing the stream causes PINS to close the Subscribe stream with an
+// error, so the stream is not half-closed. Clients such as ygnmi call CloseSend
+// right after sending the request and keep receiving, so the stream stays
+// open until Recv fails, its context is done or the test completes.
+func (sc *subscribeClientWrap) CloseSend() error {
+	return nil
+}
+
+func (c *clientWrap) Subscribe(ctx context.Context, opts ...grpc.CallOption) (gpb.GNMI_SubscribeClient, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	sub, err := c.GNMIClient.Subscribe(ctx, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &subscribeClientWrap{GNMI_SubscribeClient: sub, client: c, sub: openSubscriptions.add(ctx, c.dut, cancel)}, nil
+}
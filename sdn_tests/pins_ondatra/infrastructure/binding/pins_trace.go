@@ -0,0 +1,89 @@
+package pinsbind
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/grpctrace"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/replaybackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
+	"google.golang.org/grpc"
+)
+
+var (
+	traceDir  = flag.String("grpc_trace_dir", "", "record the gRPC traffic with the DUTs to per-test trace files in this directory.")
+	replayDir = flag.String("grpc_replay_dir", "", "replay the gRPC traffic recorded with --grpc_trace_dir from this directory instead of reserving switches.")
+)
+
+// recorder records the gRPC traffic when --grpc_trace_dir is set.
+var recorder *grpctrace.Recorder
+
+// Tests using testhelper.NewTearDownOptions get their gRPC traffic recorded to
+// their own trace.
+func init() {
+	testhelper.RegisterTestHook(func(t *testing.T, _ string) {
+		grpctrace.SetTest(t)
+	})
+}
+
+// setupTrace creates the recorder and the replay backend requested by the
+// flags.
+func setupTrace() error {
+	if *replayDir != "" && backend == nil {
+		b, err := replaybackend.New(*replayDir)
+		if err != nil {
+			return fmt.Errorf("failed to create replay backend: %v", err)
+		}
+		backend = b
+	}
+	if *traceDir != "" && recorder == nil {
+		r, err := grpctrace.NewRecorder(*traceDir)
+		if err != nil {
+			return err
+		}
+		recorder = r
+	}
+	return nil
+}
+
+// traceOpts returns the dial options recording the traffic of the DUT.
+func traceOpts(dut string) []grpc.DialOption {
+	if recorder == nil {
+		return nil
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(recorder.UnaryInterceptor(dut)),
+		grpc.WithChainStreamInterceptor(recorder.StreamInterceptor(dut)),
+	}
+}
+
+// recordTopology stores the reserved topology next to the traces so that the
+// replay backend can reserve it again.
+func recordTopology(r *bindingbackend.ReservedTopology) error {
+	if recorder == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal topology %s: %v", r.ID, err)
+	}
+	if err := os.WriteFile(filepath.Join(recorder.Dir(), grpctrace.TopologyFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to record topology %s: %v", r.ID, err)
+	}
+	return nil
+}
+
+// closeTrace flushes the recorded traces.
+func closeTrace() error {
+	if recorder == nil {
+		return nil
+	}
+	err := recorder.Close()
+	recorder = nil
+	return err
+}
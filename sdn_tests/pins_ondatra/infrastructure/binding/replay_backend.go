@@ -0,0 +1,158 @@
+// Package replaybackend implements a backend that replays the gRPC traffic
+// recorded with --grpc_trace_dir instead of talking to switches. The reserved
+// topology is the one stored in the trace directory and every RPC is answered
+// from the trace of the running test.
+//
+// Use it by running the tests with --grpc_replay_dir=<trace directory>, or by
+// setting the backend before running the tests:
+//
+//	func TestMain(m *testing.M) {
+//		b, err := replaybackend.New(dir)
+//		...
+//		pinsbind.SetBackend(b)
+//		ondatra.RunTests(m, pinsbind.New)
+//	}
+package replaybackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/ondatra/binding"
+	opb "github.com/openconfig/ondatra/proto"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/grpctrace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/local"
+)
+
+// Backend replays a trace directory.
+type Backend struct {
+	dir    string
+	player *grpctrace.Player
+	// server accepts the connections of the replayed clients, the RPCs
+	// themselves never reach it.
+	server *grpc.Server
+	addr   string
+
+	mu       sync.Mutex
+	topology *bindingbackend.ReservedTopology
+	devices  map[string]string // device name by service address
+}
+
+// New creates a backend replaying the traces of the given directory.
+func New(dir string) (*Backend, error) {
+	player, err := grpctrace.NewPlayer(dir)
+	if err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for replayed connections: %v", err)
+	}
+	b := &Backend{
+		dir:    dir,
+		player: player,
+		server: grpc.NewServer(),
+		addr:   lis.Addr().String(),
+	}
+	go b.server.Serve(lis)
+	return b, nil
+}
+
+// loadTopology reads the recorded topology.
+func (b *Backend) loadTopology() (*bindingbackend.ReservedTopology, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.topology != nil {
+		return b.topology, nil
+	}
+	path := filepath.Join(b.dir, grpctrace.TopologyFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded topology: %v", err)
+	}
+	r := &bindingbackend.ReservedTopology{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse recorded topology %s: %v", path, err)
+	}
+	b.devices = map[string]string{}
+	for _, dut := range r.DUTs {
+		// The switches are not reachable over SSH in replay.
+		dut.NoSSH = true
+		for _, addr := range dut.GRPC.Addr {
+			b.devices[addr] = dut.Name
+		}
+	}
+	for _, ate := range r.ATEs {
+		for _, addr := range ate.GRPC.Addr {
+			b.devices[addr] = ate.Name
+		}
+	}
+	b.topology = r
+	return r, nil
+}
+
+// ReserveTopology returns the recorded topology regardless of the testbed.
+func (b *Backend) ReserveTopology(ctx context.Context, tb *opb.Testbed, runtime, waitTime time.Duration, partial map[string]string) (*bindingbackend.ReservedTopology, error) {
+	return b.loadTopology()
+}
+
+// FetchTopology returns the recorded topology regardless of the ID.
+func (b *Backend) FetchTopology(ctx context.Context, id string) (*bindingbackend.ReservedTopology, error) {
+	return b.loadTopology()
+}
+
+// Release does nothing, there are no devices to release.
+func (b *Backend) Release(ctx context.Context) error {
+	return nil
+}
+
+// DialGRPC returns a connection whose RPCs are answered from the traces of the
+// device serving the address. The transport credentials of the options are
+// replaced with local ones, which still accept per-RPC credentials requiring
+// transport security, e.g. the passwords of TLS and mTLS devices. They are
+// never sent since the RPCs do not leave the process.
+func (b *Backend) DialGRPC(ctx context.Context, addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	b.mu.Lock()
+	name, ok := b.devices[addr]
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("address %s is not part of the recorded topology", addr)
+	}
+	opts = append(opts,
+		grpc.WithTransportCredentials(local.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(b.player.UnaryInterceptor(name)),
+		grpc.WithChainStreamInterceptor(b.player.StreamInterceptor(name)))
+	conn, err := grpc.DialContext(ctx, b.addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("DialContext(%s, %v) : %v", b.addr, opts, err)
+	}
+	return conn, nil
+}
+
+// DialConsole is not supported, consoles are not recorded.
+func (b *Backend) DialConsole(ctx context.Context, dut *binding.AbstractDUT) (binding.ConsoleClient, error) {
+	return nil, fmt.Errorf("console of %s is not available in replay", dut.Name())
+}
+
+// GNMIClient wraps the grpc connection under gnmi client.
+func (b *Backend) GNMIClient(ctx context.Context, dut *binding.AbstractDUT, conn *grpc.ClientConn) (gpb.GNMIClient, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("conn is nil")
+	}
+	return gpb.NewGNMIClient(conn), nil
+}
+
+// Close stops accepting replayed connections.
+func (b *Backend) Close() error {
+	b.server.Stop()
+	return nil
+}
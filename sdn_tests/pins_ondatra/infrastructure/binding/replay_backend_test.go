@@ -0,0 +1,183 @@
+package replaybackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/openconfig/ygot/ygot"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/fakebackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/grpctrace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	opb "github.com/openconfig/ondatra/proto"
+)
+
+const testTimeout = 10 * time.Second
+
+// reply is what the client got back from a call.
+type reply struct {
+	Msgs []proto.Message
+	Code codes.Code
+}
+
+func mustPath(t *testing.T, s string) *gpb.Path {
+	t.Helper()
+	p, err := ygot.StringToStructuredPath(s)
+	if err != nil {
+		t.Fatalf("StringToStructuredPath(%s) failed: %v", s, err)
+	}
+	return p
+}
+
+// subscribe sends the request and receives the responses until the stream
+// ends.
+func subscribe(ctx context.Context, c gpb.GNMIClient, req *gpb.SubscribeRequest) reply {
+	sub, err := c.Subscribe(ctx)
+	if err != nil {
+		return reply{Code: status.Code(err)}
+	}
+	if err := sub.Send(req); err != nil {
+		return reply{Code: status.Code(err)}
+	}
+	var r reply
+	for {
+		resp, err := sub.Recv()
+		if errors.Is(err, io.EOF) {
+			return r
+		}
+		if err != nil {
+			r.Code = status.Code(err)
+			return r
+		}
+		r.Msgs = append(r.Msgs, resp)
+	}
+}
+
+// exchange makes successful and failing unary and streaming gNMI calls and
+// returns their replies.
+func exchange(t *testing.T, conn *grpc.ClientConn) []reply {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	c := gpb.NewGNMIClient(conn)
+	var replies []reply
+
+	caps, err := c.Capabilities(ctx, &gpb.CapabilityRequest{})
+	replies = append(replies, reply{Msgs: []proto.Message{caps}, Code: status.Code(err)})
+
+	_, err = c.Set(ctx, &gpb.SetRequest{Update: []*gpb.Update{{
+		Path: mustPath(t, "/interfaces/interface[name=Ethernet1/1/1]/config/mtu"),
+		Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`"not a number"`)}},
+	}}})
+	replies = append(replies, reply{Code: status.Code(err)})
+
+	replies = append(replies, subscribe(ctx, c, &gpb.SubscribeRequest{
+		Request: &gpb.SubscribeRequest_Subscribe{Subscribe: &gpb.SubscriptionList{
+			Mode:         gpb.SubscriptionList_ONCE,
+			Subscription: []*gpb.Subscription{{Path: mustPath(t, "/interfaces/interface[name=Ethernet1/1/1]/state/name")}},
+		}},
+	}))
+	// A Subscribe stream must start with a SubscriptionList.
+	replies = append(replies, subscribe(ctx, c, &gpb.SubscribeRequest{}))
+	return replies
+}
+
+// record records the exchange with a fake DUT to the directory and returns its
+// replies.
+func record(t *testing.T, dir string) []reply {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	fake := fakebackend.New()
+	defer fake.Close()
+	topo, err := fake.ReserveTopology(ctx, &opb.Testbed{Duts: []*opb.Device{{Id: "DUT", Ports: []*opb.Port{{Id: "port1"}}}}}, time.Minute, 0, nil)
+	if err != nil {
+		t.Fatalf("ReserveTopology() failed: %v", err)
+	}
+	defer fake.Release(ctx)
+	data, err := json.Marshal(topo)
+	if err != nil {
+		t.Fatalf("Failed to marshal topology: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, grpctrace.TopologyFile), data, 0644); err != nil {
+		t.Fatalf("Failed to write topology: %v", err)
+	}
+
+	recorder, err := grpctrace.NewRecorder(dir)
+	if err != nil {
+		t.Fatalf("NewRecorder() failed: %v", err)
+	}
+	dut := topo.DUTs[0]
+	conn, err := fake.DialGRPC(ctx, dut.GRPC.Addr[bindingbackend.GNMI],
+		grpc.WithChainUnaryInterceptor(recorder.UnaryInterceptor(dut.Name)),
+		grpc.WithChainStreamInterceptor(recorder.StreamInterceptor(dut.Name)))
+	if err != nil {
+		t.Fatalf("DialGRPC() failed: %v", err)
+	}
+	defer conn.Close()
+	replies := exchange(t, conn)
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Failed to close the recorder: %v", err)
+	}
+	return replies
+}
+
+// passwordCredentials are per-RPC credentials requiring transport security,
+// like the inventory credentials of pinsbackend.
+type passwordCredentials struct{}
+
+func (passwordCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"username": "admin", "password": "admin"}, nil
+}
+
+func (passwordCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+func TestRecordReplay(t *testing.T) {
+	grpctrace.SetTest(t)
+	dir := t.TempDir()
+	want := record(t, dir)
+	var got []codes.Code
+	for _, r := range want {
+		got = append(got, r.Code)
+	}
+	if diff := cmp.Diff([]codes.Code{codes.OK, codes.InvalidArgument, codes.OK, codes.InvalidArgument}, got); diff != "" {
+		t.Fatalf("Recorded status codes differ (-want +got):\n%s", diff)
+	}
+
+	b, err := New(dir)
+	if err != nil {
+		t.Fatalf("New(%s) failed: %v", dir, err)
+	}
+	defer b.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	topo, err := b.ReserveTopology(ctx, nil, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("ReserveTopology() failed: %v", err)
+	}
+	// The credentials of the recording are still passed by the clients.
+	conn, err := b.DialGRPC(ctx, topo.DUTs[0].GRPC.Addr[bindingbackend.GNMI], grpc.WithPerRPCCredentials(passwordCredentials{}))
+	if err != nil {
+		t.Fatalf("DialGRPC() failed: %v", err)
+	}
+	defer conn.Close()
+
+	if diff := cmp.Diff(want, exchange(t, conn), protocmp.Transform()); diff != "" {
+		t.Errorf("Replayed replies differ from the recording (-want +got):\n%s", diff)
+	}
+}
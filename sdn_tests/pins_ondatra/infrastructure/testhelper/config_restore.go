@@ -0,0 +1,236 @@
+package testhelper
+
+// This file contains the restoration of the switch config captured when the
+// test started.
+import (
+	"reflect"
+	"testing"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"github.com/openconfig/ygot/ytypes"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// maxReportedPaths bounds the paths listed when the restored config still
+// differs from the captured one.
+const maxReportedPaths = 10
+
+// Function pointers that interact with the switch. They enable unit testing
+// of methods that interact with the switch.
+var (
+	testhelperConfigGet = func(t *testing.T, d *ondatra.DUTDevice) []byte {
+		return GetConfig(t, d)
+	}
+)
+
+// configSnapshot is the config of a switch captured when the test started.
+type configSnapshot struct {
+	dut    *ondatra.DUTDevice
+	config []byte
+}
+
+// WithConfigRestore captures the config of the DUT and of its peer. Teardown
+// restores the captured config with a gNMI Set of the differences, so that a
+// test failing in the middle does not leave the switches dirty for the next
+// tests. Only the OpenConfig config is restored.
+func (o TearDownOptions) WithConfigRestore(t *testing.T) TearDownOptions {
+	for _, info := range []DUTInfo{o.DUTDeviceInfo, o.DUTPeerDeviceInfo} {
+		if info.name == "" {
+			continue
+		}
+		d, err := testhelperDUTByNameGet(t, info.name)
+		if err != nil {
+			t.Errorf("Config of %v is not captured: %v", info.name, err)
+			continue
+		}
+		config := testhelperConfigGet(t, d)
+		if config == nil {
+			t.Errorf("Config of %v is not captured, it will not be restored", info.name)
+			continue
+		}
+		o.configSnapshots = append(o.configSnapshots, configSnapshot{dut: d, config: config})
+	}
+	return o
+}
+
+// restoreConfig sets the config of the switch back to the snapshot and
+// verifies that it no longer differs.
+func restoreConfig(t *testing.T, s configSnapshot) error {
+	name := testhelperDUTNameGet(s.dut)
+	current := testhelperConfigGet(t, s.dut)
+	if current == nil {
+		return errors.Errorf("failed to fetch the config of %v", name)
+	}
+	req, err := configRestoreRequest(name, current, s.config)
+	if err != nil {
+		return errors.Wrapf(err, "failed to diff the config of %v", name)
+	}
+	if len(req.GetUpdate()) == 0 && len(req.GetDelete()) == 0 {
+		log.Infof("Config of %v is unchanged", name)
+		return nil
+	}
+
+	log.Infof("Restoring config of %v: %v updates, %v deletes", name, len(req.GetUpdate()), len(req.GetDelete()))
+	if _, err := gnmiSet(t, s.dut, req); err != nil {
+		return errors.Wrapf(err, "gNMI Set restoring the config of %v failed", name)
+	}
+
+	restored := testhelperConfigGet(t, s.dut)
+	if restored == nil {
+		return errors.Errorf("failed to fetch the restored config of %v", name)
+	}
+	if req, err = configRestoreRequest(name, restored, s.config); err != nil {
+		return errors.Wrapf(err, "failed to diff the restored config of %v", name)
+	}
+	if paths := requestPaths(req); len(paths) > 0 {
+		if len(paths) > maxReportedPaths {
+			paths = append(paths[:maxReportedPaths], "...")
+		}
+		return errors.Errorf("config of %v still differs from the captured config after the restore, in %v", name, paths)
+	}
+	return nil
+}
+
+// configRestoreRequest returns the Set request turning the from config into
+// the to config. Configs are JSON IETF encoded OpenConfig roots, fields outside
+// of the OpenConfig schema and leaves without config are ignored.
+func configRestoreRequest(name string, from, to []byte) (*gpb.SetRequest, error) {
+	schema, err := oc.Schema()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the OpenConfig schema")
+	}
+	// The config containers are the shadow paths of the OpenConfig structs.
+	fromRoot, toRoot := &oc.Root{}, &oc.Root{}
+	if err := oc.Unmarshal(from, fromRoot, &ytypes.IgnoreExtraFields{}, &ytypes.PreferShadowPath{}); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the current config")
+	}
+	if err := oc.Unmarshal(to, toRoot, &ytypes.IgnoreExtraFields{}, &ytypes.PreferShadowPath{}); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the captured config")
+	}
+	diff, err := ygot.Diff(fromRoot, toRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &gpb.SetRequest{Prefix: &gpb.Path{Origin: "openconfig", Target: name}}
+	var deletes []*gpb.Path
+	for _, p := range diff.GetDelete() {
+		if path, _, ok := configLeaf(schema, fromRoot, p); ok {
+			deletes = append(deletes, listEntryOfKey(path))
+		}
+	}
+	req.Delete = pruneDeletes(deletes)
+	for _, u := range diff.GetUpdate() {
+		path, val, ok := configLeaf(schema, toRoot, u.GetPath())
+		if !ok {
+			continue
+		}
+		// Leaves are encoded like the Ondatra config pushes: identityrefs and
+		// enums with their module, 64-bit integers as strings.
+		js, err := ygot.Marshal7951(val, &ygot.RFC7951JSONConfig{AppendModuleName: true})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode value of %v", path)
+		}
+		req.Update = append(req.Update, &gpb.Update{
+			Path: path,
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: js}},
+		})
+	}
+	return req, nil
+}
+
+// configLeaf returns the config path and the value in root of a leaf of a
+// diff. The diff spells the leaves with their state path, which is turned into
+// the config path. It returns false for leaves without config.
+func configLeaf(schema *ytypes.Schema, root *oc.Root, p *gpb.Path) (*gpb.Path, any, bool) {
+	if elems := p.GetElem(); len(elems) >= 2 && elems[len(elems)-2].GetName() == "state" {
+		p = proto.Clone(p).(*gpb.Path)
+		p.GetElem()[len(elems)-2].Name = "config"
+	}
+	nodes, err := ytypes.GetNode(schema.RootSchema(), root, p, &ytypes.PreferShadowPath{})
+	if err != nil || len(nodes) == 0 {
+		return nil, nil, false
+	}
+	v := reflect.ValueOf(nodes[0].Data)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil, false
+		}
+		v = v.Elem()
+	}
+	return p, v.Interface(), true
+}
+
+// listEntryOfKey returns the path of the list entry if p is the path of one of
+// its keys, so that the entries added by the test are deleted as a whole. It
+// returns p otherwise.
+func listEntryOfKey(p *gpb.Path) *gpb.Path {
+	elems := p.GetElem()
+	entry := len(elems) - 2
+	if entry >= 0 && elems[entry].GetName() == "config" {
+		entry--
+	}
+	if entry < 0 {
+		return p
+	}
+	if _, ok := elems[entry].GetKey()[elems[len(elems)-1].GetName()]; !ok {
+		return p
+	}
+	return &gpb.Path{Elem: elems[:entry+1]}
+}
+
+// pruneDeletes removes the duplicate deletes and the deletes below another
+// deleted path.
+func pruneDeletes(deletes []*gpb.Path) []*gpb.Path {
+	var pruned []*gpb.Path
+	for i, d := range deletes {
+		covered := false
+		for j, o := range deletes {
+			if j != i && isPathPrefix(o, d) && (len(o.GetElem()) < len(d.GetElem()) || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			pruned = append(pruned, d)
+		}
+	}
+	return pruned
+}
+
+// isPathPrefix returns whether the elements of p start with the elements of
+// prefix.
+func isPathPrefix(prefix, p *gpb.Path) bool {
+	pe, e := prefix.GetElem(), p.GetElem()
+	if len(pe) > len(e) {
+		return false
+	}
+	for i := range pe {
+		if !proto.Equal(pe[i], e[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestPaths returns the paths updated or deleted by the request.
+func requestPaths(req *gpb.SetRequest) []string {
+	var paths []string
+	for _, u := range req.GetUpdate() {
+		if p, err := ygot.PathToString(u.GetPath()); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	for _, d := range req.GetDelete() {
+		if p, err := ygot.PathToString(d); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
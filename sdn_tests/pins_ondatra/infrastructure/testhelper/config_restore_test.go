@@ -0,0 +1,44 @@
+package testhelper_test
+
+import (
+	"testing"
+
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/openconfig/ygot/ygot"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
+)
+
+func TestWithConfigRestore(t *testing.T) {
+	dut := ondatra.DUT(t, "DUT")
+	port := dut.Port(t, "port1").Name()
+	intf := gnmi.OC().Interface(port)
+	gnmi.Replace(t, dut, intf.Description().Config(), "captured")
+	gnmi.Replace(t, dut, intf.Mtu().Config(), 9100)
+	const addr = "10.0.0.1"
+	ipv4 := intf.Subinterface(0).Ipv4().Address(addr)
+
+	t.Run("ChangeConfig", func(t *testing.T) {
+		defer testhelper.NewTearDownOptions(t).WithConfigRestore(t).Teardown(t)
+		gnmi.Replace(t, dut, intf.Description().Config(), "changed")
+		gnmi.Delete(t, dut, intf.Mtu().Config())
+		// Enums must be restored with their module.
+		gnmi.Replace(t, dut, intf.Ethernet().PortSpeed().Config(), oc.IfEthernet_ETHERNET_SPEED_SPEED_400GB)
+		// Entries added by the test must be deleted.
+		gnmi.Replace(t, dut, ipv4.Config(), &oc.Interface_Subinterface_Ipv4_Address{Ip: ygot.String(addr), PrefixLength: ygot.Uint8(24)})
+	})
+
+	if got, want := gnmi.Get(t, dut, intf.Description().Config()), "captured"; got != want {
+		t.Errorf("Restored description = %q, want %q", got, want)
+	}
+	if got, want := gnmi.Get(t, dut, intf.Mtu().Config()), uint16(9100); got != want {
+		t.Errorf("Restored MTU = %v, want %v", got, want)
+	}
+	if got, want := gnmi.Get(t, dut, intf.Ethernet().PortSpeed().Config()), oc.IfEthernet_ETHERNET_SPEED_SPEED_100GB; got != want {
+		t.Errorf("Restored port speed = %v, want %v", got, want)
+	}
+	if _, ok := gnmi.Lookup(t, dut, ipv4.Ip().Config()).Val(); ok {
+		t.Errorf("IPv4 address %v added by the test is not deleted", addr)
+	}
+}
@@ -0,0 +1,92 @@
+package testhelper
+
+// This file contains helper methods to capture the serial console of the
+// switch, e.g. to debug a switch that hangs during reboot.
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/binding"
+	"github.com/pkg/errors"
+)
+
+// Function pointers that interact with the switch. They enable unit testing
+// of methods that interact with the switch.
+var (
+	consoleClientGet = func(ctx context.Context, d *ondatra.DUTDevice) (binding.ConsoleClient, error) {
+		return d.RawAPIs().BindingDUT().DialConsole(ctx)
+	}
+)
+
+// ConsoleCapture records the console output of a switch to a file.
+type ConsoleCapture struct {
+	path   string
+	client binding.ConsoleClient
+	file   *os.File
+	done   chan struct{}
+}
+
+// CaptureConsole starts recording the console output of the switch to
+// <switch>_console.log in the output directory of the test. The recording
+// continues until Stop is called.
+func CaptureConsole(t *testing.T, d *ondatra.DUTDevice) (*ConsoleCapture, error) {
+	name := testhelperDUTNameGet(d)
+	dir, err := testOutputDir(t)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := consoleClientGet(context.Background(), d)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to console of %v", name)
+	}
+	path := filepath.Join(dir, name+"_console.log")
+	file, err := os.Create(path)
+	if err != nil {
+		closeConsole(client)
+		return nil, errors.Wrapf(err, "failed to create console log %v", path)
+	}
+
+	c := &ConsoleCapture{
+		path:   path,
+		client: client,
+		file:   file,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		if _, err := io.Copy(file, client.Stdout()); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Warningf("Console capture of %v stopped: %v", name, err)
+		}
+	}()
+	log.Infof("Capturing console of %v to %v", name, path)
+	return c, nil
+}
+
+// Path returns the file that the console output is written to.
+func (c *ConsoleCapture) Path() string {
+	return c.path
+}
+
+// Stop ends the recording and closes the console connection.
+func (c *ConsoleCapture) Stop() error {
+	err := closeConsole(c.client)
+	<-c.done
+	if e := c.file.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+func closeConsole(client binding.ConsoleClient) error {
+	if closer, ok := client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return client.Stdout().Close()
+}
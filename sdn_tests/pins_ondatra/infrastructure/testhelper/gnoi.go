@@ -3,8 +3,15 @@ package testhelper
 // This file contains helper method for gNOI services such as
 // Reboot, Install etc.
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,9 +19,13 @@ import (
 	"github.com/openconfig/ondatra"
 	"github.com/openconfig/ondatra/gnmi"
 	"github.com/pkg/errors"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
+	"google.golang.org/protobuf/proto"
 
 	healthzpb "github.com/openconfig/gnoi/healthz"
 	syspb "github.com/openconfig/gnoi/system"
+	tpb "github.com/openconfig/gnoi/types"
+	"google.golang.org/protobuf/types/known/anypb"
 )
 
 // Function pointers that interact with the switch. They enable unit testing
@@ -31,8 +42,22 @@ var (
 	gnmiSystemBootTimeGet = func(t *testing.T, d *ondatra.DUTDevice) uint64 {
 		return gnmi.Get(t, d, gnmi.OC().System().BootTime().State())
 	}
+
+	testhelperServicesWait = func(ctx context.Context, d *ondatra.DUTDevice, services ...bindingbackend.GRPCService) error {
+		w, ok := d.RawAPIs().BindingDUT().(serviceWaiter)
+		if !ok {
+			return errors.Errorf("binding of %v cannot wait for services", d.Name())
+		}
+		return w.WaitForServices(ctx, services...)
+	}
 )
 
+// serviceWaiter is implemented by bindings that can probe the gRPC services of
+// a DUT.
+type serviceWaiter interface {
+	WaitForServices(ctx context.Context, services ...bindingbackend.GRPCService) error
+}
+
 // RebootParams specify the reboot parameters used by the Reboot API.
 type RebootParams struct {
 	request       any
@@ -40,6 +65,12 @@ type RebootParams struct {
 	checkInterval time.Duration
 	lmTTkrID      string // latency measurement testtracker UUID
 	lmTitle       string // latency measurement title
+	// captureConsole records the switch console during the reboot.
+	captureConsole bool
+	delay          time.Duration
+	// postConditions override the post-conditions of the reboot method
+	// verified by RebootWithStatus.
+	postConditions *RebootPostConditions
 }
 
 // NewRebootParams returns RebootParams structure with default values.
@@ -74,28 +105,41 @@ func (p *RebootParams) WithRequest(r any) *RebootParams {
 }
 
 // WithLatencyMeasurement adds testtracker uuid and title for latency measurement.
+// Reboot then records the time of every reboot milestone and waits for the
+// ports that were up before the reboot to be up again. The latency record is
+// appended to reboot_latency.jsonl in the test output directory.
 func (p *RebootParams) WithLatencyMeasurement(testTrackerID, title string) *RebootParams {
 	p.lmTTkrID = testTrackerID
 	p.lmTitle = title
 	return p
 }
 
-// measureLatency returns true if latency measurement parameters are set and valid.
-func (p *RebootParams) measureLatency() bool {
-	return p.waitTime > 0 && p.lmTitle != ""
+// WithConsoleCapture records the switch console to the test output directory
+// while the reboot is in progress.
+func (p *RebootParams) WithConsoleCapture() *RebootParams {
+	p.captureConsole = true
+	return p
 }
 
-// Reboot sends a RebootRequest message to the switch. It waits for a specified
-// amount of time for the switch reboot to be successful. A switch reboot is
-// considered to be successful if the gNOI server is up and the boot time is
-// after the reboot request time.
-func Reboot(t *testing.T, d *ondatra.DUTDevice, params *RebootParams) error {
-	if params.waitTime < params.checkInterval {
-		return errors.Errorf("wait time:%v cannot be less than check interval:%v", params.waitTime, params.checkInterval)
-	}
+// WithDelay delays the reboot by the given duration. The wait time starts when
+// the delay is over.
+func (p *RebootParams) WithDelay(delay time.Duration) *RebootParams {
+	p.delay = delay
+	return p
+}
 
+// WithPostConditions overrides the post-conditions of the reboot method that
+// RebootWithStatus verifies after the reboot.
+func (p *RebootParams) WithPostConditions(c RebootPostConditions) *RebootParams {
+	p.postConditions = &c
+	return p
+}
+
+// rebootRequest returns the reboot request of the parameters. The request
+// given by the user is not modified.
+func (p *RebootParams) rebootRequest() (*syspb.RebootRequest, error) {
 	var req *syspb.RebootRequest
-	switch v := params.request.(type) {
+	switch v := p.request.(type) {
 	case syspb.RebootMethod:
 		// User only specified the reboot type. Construct reboot request.
 		req = &syspb.RebootRequest{
@@ -106,16 +150,67 @@ func Reboot(t *testing.T, d *ondatra.DUTDevice, params *RebootParams) error {
 		// Use the specified reboot request.
 		req = v
 	default:
-		return errors.New("invalid reboot request (valid parameters are RebootRequest protobuf and RebootMethod)")
+		return nil, errors.New("invalid reboot request (valid parameters are RebootRequest protobuf and RebootMethod)")
+	}
+	if p.delay > 0 {
+		req = proto.Clone(req).(*syspb.RebootRequest)
+		req.Delay = uint64(p.delay.Nanoseconds())
+	}
+	return req, nil
+}
+
+// measureLatency returns true if latency measurement parameters are set and valid.
+func (p *RebootParams) measureLatency() bool {
+	return p.waitTime > 0 && p.lmTitle != ""
+}
+
+// Reboot sends a RebootRequest message to the switch. It waits for a specified
+// amount of time for the switch reboot to be successful. A switch reboot is
+// considered to be successful if the gNOI and gNMI servers are up and the boot
+// time is after the reboot request time. The servers are polled at the check
+// interval when the latency is measured, otherwise Reboot waits for them with
+// WaitForServices. When the latency is measured, Reboot also waits, within the
+// wait time, for the ports that were up before the reboot to be up again. Ports
+// still down do not fail the reboot, they leave the latency record incomplete.
+// The milestones are as accurate as the check interval.
+func Reboot(t *testing.T, d *ondatra.DUTDevice, params *RebootParams) error {
+	if params.waitTime < params.checkInterval {
+		return errors.Errorf("wait time:%v cannot be less than check interval:%v", params.waitTime, params.checkInterval)
+	}
+
+	req, err := params.rebootRequest()
+	if err != nil {
+		return err
+	}
+
+	if params.captureConsole {
+		// Missing console access must not fail the reboot.
+		capture, err := CaptureConsole(t, d)
+		if err != nil {
+			log.Warningf("Console of %v is not captured: %v", testhelperDUTNameGet(d), err)
+		} else {
+			defer capture.Stop()
+		}
+	}
+
+	// Ports are only checked when the latency is measured.
+	var latency *RebootLatency
+	checkInterval := params.checkInterval
+	if params.measureLatency() {
+		if latency, err = newRebootLatency(t, d, params, req.GetMethod().String()); err != nil {
+			return err
+		}
 	}
 
 	log.Infof("Rebooting %v switch", testhelperDUTNameGet(d))
 	timeBeforeReboot := time.Now().UnixNano()
 	systemClient := gnoiSystemClientGet(t, d)
 
+	latency.start()
 	if _, err := systemClient.Reboot(context.Background(), req); err != nil {
 		return errors.Wrapf(err, "reboot RPC failed")
 	}
+	latency.reach(MilestoneRPCAccepted)
 
 	if params.waitTime == 0 {
 		// User did not request a wait time which implies that the API did not verify whether
@@ -123,34 +218,78 @@ func Reboot(t *testing.T, d *ondatra.DUTDevice, params *RebootParams) error {
 		return nil
 	}
 
-	log.Infof("Polling gNOI server reachability in %v intervals for max duration of %v", params.checkInterval, params.waitTime)
-	for timeout := time.Now().Add(params.waitTime); time.Now().Before(timeout); {
+	log.Infof("Polling gNOI server reachability in %v intervals for max duration of %v", checkInterval, params.waitTime)
+	rebooted := false
+	timeout := time.Now().Add(params.delay + params.waitTime)
+	ctx, cancel := context.WithDeadline(context.Background(), timeout)
+	defer cancel()
+	for time.Now().Before(timeout) {
 		// The switch backend might not have processed the request or might take
 		// sometime to execute the request. So wait for check interval time and
 		// later verify that the switch rebooted within the specified wait time.
-		time.Sleep(params.checkInterval)
+		time.Sleep(checkInterval)
 		doneTime := time.Now()
 		timeElapsed := (doneTime.UnixNano() - timeBeforeReboot) / int64(time.Second)
 
-		if err := GNOIAble(t, d); err != nil {
-			log.Infof("gNOI server not up after %v seconds", timeElapsed)
-			continue
+		if !rebooted {
+			if latency == nil {
+				// Without milestones to record, block until the servers
+				// answer instead of polling them.
+				if err := WaitForServices(ctx, d, bindingbackend.GNOI, bindingbackend.GNMI); err != nil {
+					log.Infof("gNOI and gNMI servers not up after %v seconds: %v", timeElapsed, err)
+					continue
+				}
+				timeElapsed = (time.Now().UnixNano() - timeBeforeReboot) / int64(time.Second)
+				log.Infof("gNOI and gNMI servers up after %v seconds", timeElapsed)
+			} else {
+				if err := GNOIAble(t, d); err != nil {
+					latency.reach(MilestoneGNOIUnreachable)
+					log.Infof("gNOI server not up after %v seconds", timeElapsed)
+					continue
+				}
+				if latency.hasReached(MilestoneGNOIUnreachable) {
+					latency.reach(MilestoneGNOIReachable)
+				}
+				log.Infof("gNOI server up after %v seconds", timeElapsed)
+
+				if err := GNMIAble(t, d); err != nil {
+					log.Infof("gNMI server not up after %v seconds", timeElapsed)
+					continue
+				}
+				// gNMI answering before the switch went down is not the reboot.
+				if latency.hasReached(MilestoneGNOIUnreachable) {
+					latency.reach(MilestoneGNMIReachable)
+				}
+			}
+
+			// An extra check to ensure that the system has rebooted.
+			if bootTime := gnmiSystemBootTimeGet(t, d); bootTime < uint64(timeBeforeReboot) {
+				log.Infof("Switch has not rebooted after %v seconds", timeElapsed)
+				continue
+			}
+			latency.reach(MilestoneBootTimeUpdated)
+			log.Infof("Switch rebooted after %v seconds", timeElapsed)
+			if latency == nil {
+				return nil
+			}
+			rebooted = true
 		}
-		log.Infof("gNOI server up after %v seconds", timeElapsed)
 
-		// An extra check to ensure that the system has rebooted.
-		if bootTime := gnmiSystemBootTimeGet(t, d); bootTime < uint64(timeBeforeReboot) {
-			log.Infof("Switch has not rebooted after %v seconds", timeElapsed)
+		if !latency.portsUp(t, d) {
+			log.Infof("Ports up before the reboot are not up after %v seconds", timeElapsed)
 			continue
 		}
-
-		log.Infof("Switch rebooted after %v seconds", timeElapsed)
+		latency.reach(MilestonePortsUp)
+		latency.write(t, true)
 		return nil
 	}
 
-	err := errors.Errorf("failed to reboot %v", testhelperDUTNameGet(d))
-
-	return err
+	latency.write(t, false)
+	if rebooted {
+		log.Warningf("Ports of %v up before the reboot are not all up after %v, the reboot latency is incomplete", testhelperDUTNameGet(d), params.delay+params.waitTime)
+		return nil
+	}
+	return errors.Errorf("failed to reboot %v", testhelperDUTNameGet(d))
 }
 
 // GNOIAble returns whether the gNOI server on the specified device is reachable
@@ -161,7 +300,164 @@ func GNOIAble(t *testing.T, d *ondatra.DUTDevice) error {
 	return err
 }
 
-// HealthzGetPortDebugData returns port debug data given an interface.
-func HealthzGetPortDebugData(t *testing.T, d *ondatra.DUTDevice, intfName string) error {
-	return fmt.Errorf("unimplemented method HealthzGetPortDebugData")
+// WaitForServices blocks until the given gRPC services of the switch answer a
+// lightweight probe or until the context is done, e.g.
+// WaitForServices(ctx, dut, bindingbackend.GNMI, bindingbackend.P4RT). It
+// waits for all the services of the switch if none is given.
+func WaitForServices(ctx context.Context, d *ondatra.DUTDevice, services ...bindingbackend.GRPCService) error {
+	return testhelperServicesWait(ctx, d, services...)
+}
+
+// PortDebugData contains the debug data of a port collected through Healthz.
+type PortDebugData struct {
+	Interface string
+	Status    healthzpb.Status
+	Artifacts []*PortDebugArtifact
+}
+
+// PortDebugArtifact is an artifact of the port debug data. File artifacts are
+// saved to File in the test output directory, proto artifacts are returned in
+// Protos.
+type PortDebugArtifact struct {
+	ID     string
+	Name   string
+	File   string
+	Size   int64
+	Protos []*anypb.Any
+}
+
+// HealthzGetPortDebugData returns port debug data given an interface. It gets
+// the Healthz status of the interface component and streams all its
+// artifacts, saving the file artifacts under
+// <test output directory>/port_debug_data/<interface>/ after validating their
+// checksum.
+func HealthzGetPortDebugData(t *testing.T, d *ondatra.DUTDevice, intfName string) (*PortDebugData, error) {
+	healthzClient := gnoiHealthzClientGet(t, d)
+	resp, err := healthzClient.Get(context.Background(), &healthzpb.GetRequest{Path: healthzComponentPath(intfName)})
+	if err != nil {
+		return nil, errors.Wrapf(err, "healthz Get RPC failed for interface %v", intfName)
+	}
+
+	outDir, err := testOutputDir(t)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(outDir, "port_debug_data", strings.ReplaceAll(intfName, "/", "_"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create port debug data directory %v", dir)
+	}
+
+	data := &PortDebugData{
+		Interface: intfName,
+		Status:    resp.GetComponent().GetStatus(),
+	}
+	for _, header := range componentArtifacts(resp.GetComponent()) {
+		artifact, err := healthzArtifact(healthzClient, header, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to fetch artifact %v of interface %v", header.GetId(), intfName)
+		}
+		data.Artifacts = append(data.Artifacts, artifact)
+	}
+	log.Infof("Fetched %v port debug data artifacts of %v from %v", len(data.Artifacts), intfName, testhelperDUTNameGet(d))
+	return data, nil
+}
+
+// healthzComponentPath returns the Healthz path of the component.
+func healthzComponentPath(name string) *tpb.Path {
+	return &tpb.Path{
+		Origin: "openconfig",
+		Elem: []*tpb.PathElem{
+			{Name: "components"},
+			{Name: "component", Key: map[string]string{"name": name}},
+		},
+	}
+}
+
+// componentArtifacts returns the artifacts of the component and its
+// subcomponents.
+func componentArtifacts(c *healthzpb.ComponentStatus) []*healthzpb.ArtifactHeader {
+	artifacts := c.GetArtifacts()
+	for _, sub := range c.GetSubcomponents() {
+		artifacts = append(artifacts, componentArtifacts(sub)...)
+	}
+	return artifacts
+}
+
+// healthzArtifactTimeout bounds the streaming of a single Healthz artifact.
+const healthzArtifactTimeout = 5 * time.Minute
+
+// healthzArtifact streams an artifact, saving file artifacts to the directory.
+func healthzArtifact(client healthzpb.HealthzClient, header *healthzpb.ArtifactHeader, dir string) (*PortDebugArtifact, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthzArtifactTimeout)
+	defer cancel()
+	stream, err := client.Artifact(ctx, &healthzpb.ArtifactRequest{Id: header.GetId()})
+	if err != nil {
+		return nil, errors.Wrap(err, "healthz Artifact RPC failed")
+	}
+
+	artifact := &PortDebugArtifact{ID: header.GetId()}
+	var contents bytes.Buffer
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to receive artifact")
+		}
+		switch c := resp.GetContents().(type) {
+		case *healthzpb.ArtifactResponse_Header:
+			header = c.Header
+		case *healthzpb.ArtifactResponse_Bytes:
+			contents.Write(c.Bytes)
+		case *healthzpb.ArtifactResponse_Proto:
+			artifact.Protos = append(artifact.Protos, c.Proto)
+		}
+	}
+
+	file := header.GetFile()
+	if file == nil {
+		return artifact, nil
+	}
+	artifact.Name = file.GetName()
+	artifact.Size = int64(contents.Len())
+	if size := file.GetSize(); size > 0 && size != artifact.Size {
+		return nil, errors.Errorf("artifact %v has %v bytes, want %v", file.GetName(), artifact.Size, size)
+	}
+	if err := validateChecksum(contents.Bytes(), file.GetHash()); err != nil {
+		return nil, errors.Wrapf(err, "artifact %v is corrupted", file.GetName())
+	}
+	name := filepath.Base(file.GetName())
+	if name == "." || name == string(filepath.Separator) {
+		name = header.GetId()
+	}
+	artifact.File = filepath.Join(dir, name)
+	if err := os.WriteFile(artifact.File, contents.Bytes(), 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to save artifact to %v", artifact.File)
+	}
+	return artifact, nil
+}
+
+// validateChecksum checks the data against the hash of the artifact, if any.
+func validateChecksum(data []byte, h *tpb.HashType) error {
+	var sum []byte
+	switch h.GetMethod() {
+	case tpb.HashType_UNSPECIFIED:
+		return nil
+	case tpb.HashType_MD5:
+		s := md5.Sum(data)
+		sum = s[:]
+	case tpb.HashType_SHA256:
+		s := sha256.Sum256(data)
+		sum = s[:]
+	case tpb.HashType_SHA512:
+		s := sha512.Sum512(data)
+		sum = s[:]
+	default:
+		return errors.Errorf("unsupported hash method %v", h.GetMethod())
+	}
+	if !bytes.Equal(sum, h.GetHash()) {
+		return errors.Errorf("%v checksum mismatch: got %x, want %x", h.GetMethod(), sum, h.GetHash())
+	}
+	return nil
 }
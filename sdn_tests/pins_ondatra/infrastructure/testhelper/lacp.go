@@ -18,13 +18,21 @@ type PeerPorts struct {
 }
 
 // PeerPortsBySpeed iterates through all the available Ethernet ports on a host device, and
-// determines if they have a matching port on the peer device. All host ports with a valid peer will
-// be grouped together based on their speed.
+// determines if they are cabled to a port on the peer device. All host ports with a valid peer will
+// be grouped together based on their speed. If the reservation does not describe its cabling, the
+// peer port is the port of the peer device with the same testbed ID.
 func PeerPortsBySpeed(t *testing.T, host *ondatra.DUTDevice, peer *ondatra.DUTDevice) map[oc.E_IfEthernet_ETHERNET_SPEED][]PeerPorts {
 	peerPortsBySpeed := make(map[oc.E_IfEthernet_ETHERNET_SPEED][]PeerPorts)
 
 	for _, hostPort := range testhelperDUTPortsGet(host) {
-		peerPort := testhelperDUTPortGet(t, peer, testhelperOndatraPortIDGet(hostPort))
+		var peerPort *ondatra.Port
+		device, port, err := testhelperPeerPortIDGet(host, testhelperOndatraPortIDGet(hostPort))
+		switch {
+		case errors.Is(err, errNoLinks):
+			peerPort = portByID(peer, testhelperOndatraPortIDGet(hostPort))
+		case err == nil && device == peer.ID():
+			peerPort = testhelperDUTPortGet(t, peer, port)
+		}
 
 		// Verify the host port is UP. Otherwise, LACPDU packets will never be transmitted.
 		if got, want := testhelperIntfOperStatusGet(t, host, testhelperOndatraPortNameGet(hostPort)), oc.Interface_OperStatus_UP; got != want {
@@ -53,6 +61,17 @@ func PeerPortsBySpeed(t *testing.T, host *ondatra.DUTDevice, peer *ondatra.DUTDe
 	return peerPortsBySpeed
 }
 
+// portByID returns the port of the device with the given testbed ID, or nil if
+// the port is not reserved.
+func portByID(d *ondatra.DUTDevice, id string) *ondatra.Port {
+	for _, p := range testhelperDUTPortsGet(d) {
+		if testhelperOndatraPortIDGet(p) == id {
+			return p
+		}
+	}
+	return nil
+}
+
 // PeerPortGroupWithNumMembers returns a list of PeerPorts of size `numMembers`.
 func PeerPortGroupWithNumMembers(t *testing.T, host *ondatra.DUTDevice, peer *ondatra.DUTDevice, numMembers int) ([]PeerPorts, error) {
 	// GPINs requires that all members of a LACP LAG have the same speed. So we first group all the
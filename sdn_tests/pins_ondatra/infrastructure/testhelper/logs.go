@@ -0,0 +1,282 @@
+package testhelper
+
+// This file contains the default collection of the switch logs of failed
+// tests.
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/prototext"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	healthzpb "github.com/openconfig/gnoi/healthz"
+)
+
+// SaveLogsSSHCommands are the commands whose output is saved by SaveSwitchLogs.
+var SaveLogsSSHCommands = []string{
+	"show version",
+	"show interfaces status",
+	"docker ps -a",
+	"uptime",
+}
+
+const (
+	// saveLogsTimeout bounds the collection of the logs of a switch.
+	saveLogsTimeout = 5 * time.Minute
+	syslogPath      = "/var/log/syslog"
+)
+
+// logsDUT is implemented by bindings that tell how the logs of the switch
+// can be collected.
+type logsDUT interface {
+	HasSSH() bool
+	HasHealthz() bool
+}
+
+// Function pointers that interact with the switch. They enable unit testing
+// of methods that interact with the switch.
+var (
+	// saveLogsAccessGet returns whether the switch can be reached over SSH and
+	// serves gNOI Healthz. Both are assumed if the binding does not tell.
+	saveLogsAccessGet = func(d *ondatra.DUTDevice) (ssh, healthz bool) {
+		l, ok := d.RawAPIs().BindingDUT().(logsDUT)
+		if !ok {
+			return true, true
+		}
+		return l.HasSSH(), l.HasHealthz()
+	}
+
+	saveLogsGNMIGet = func(ctx context.Context, d *ondatra.DUTDevice, req *gpb.GetRequest) (*gpb.GetResponse, error) {
+		c, err := d.RawAPIs().BindingDUT().DialGNMI(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.Get(ctx, req)
+	}
+
+	saveLogsHealthzClientGet = func(ctx context.Context, d *ondatra.DUTDevice) (healthzpb.HealthzClient, error) {
+		c, err := d.RawAPIs().BindingDUT().DialGNOI(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.Healthz(), nil
+	}
+
+	saveLogsSyslogCopy = func(addr string, w io.Writer) error {
+		m, err := NewSSHManager(addr)
+		if err != nil {
+			return err
+		}
+		defer m.Close()
+		f, err := m.SFTPClient.Open(syslogPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %v", syslogPath)
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	}
+)
+
+// SaveSwitchLogs is the default SaveLogs of the teardown options. It saves the
+// syslog, the running config, the Healthz artifacts of the unhealthy
+// components and the output of SaveLogsSSHCommands of the DUT and of its peer
+// to <test output directory>/<savePrefix>/<switch>/. Collection errors are
+// logged and do not stop the collection. The logs needing SSH or Healthz are
+// skipped for switches without them, e.g. fakes, and the collection of a switch
+// stops after saveLogsTimeout.
+func SaveSwitchLogs(t *testing.T, savePrefix string, dut, peer DUTInfo) {
+	base, err := testOutputDir(t)
+	if err != nil {
+		log.Warningf("Logs of %v are not saved: %v", t.Name(), err)
+		return
+	}
+	for _, info := range []DUTInfo{dut, peer} {
+		if info.name == "" {
+			continue
+		}
+		dir := filepath.Join(base, strings.ReplaceAll(savePrefix, "/", "_"), info.name)
+		if err := saveSwitchLogs(t, info.name, dir); err != nil {
+			log.Warningf("Failed to save logs of %v: %v", info.name, err)
+			continue
+		}
+		t.Logf("Saved logs of %v to %v", info.name, dir)
+	}
+}
+
+func saveSwitchLogs(t *testing.T, name, dir string) error {
+	d, err := testhelperDUTByNameGet(t, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create log directory %v", dir)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), saveLogsTimeout)
+	defer cancel()
+
+	hasSSH, hasHealthz := saveLogsAccessGet(d)
+	collectors := []struct {
+		what    string
+		enabled bool
+		save    func() error
+	}{
+		{"syslog", hasSSH, func() error { return saveSyslog(name, filepath.Join(dir, "syslog")) }},
+		{"running config", true, func() error { return saveRunningConfig(ctx, d, filepath.Join(dir, "running_config.json")) }},
+		{"healthz artifacts", hasHealthz, func() error { return saveUnhealthyArtifacts(ctx, d, filepath.Join(dir, "healthz")) }},
+		{"ssh commands", hasSSH, func() error { return saveSSHCommands(name, filepath.Join(dir, "ssh_commands.txt")) }},
+	}
+	for _, c := range collectors {
+		if !c.enabled {
+			log.Infof("Not saving %v of %v, the switch does not support it", c.what, name)
+			continue
+		}
+		// SSH does not take a context, the collector is abandoned once the
+		// collection timed out.
+		errc := make(chan error, 1)
+		go func(save func() error) { errc <- save() }(c.save)
+		select {
+		case err := <-errc:
+			if err != nil {
+				log.Warningf("Failed to save %v of %v: %v", c.what, name, err)
+			}
+		case <-ctx.Done():
+			return errors.Errorf("stopped saving %v after %v", c.what, saveLogsTimeout)
+		}
+	}
+	return nil
+}
+
+func saveSyslog(addr, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %v", path)
+	}
+	defer f.Close()
+	return saveLogsSyslogCopy(addr, f)
+}
+
+// saveRunningConfig saves the config of the switch root.
+func saveRunningConfig(ctx context.Context, d *ondatra.DUTDevice, path string) error {
+	resp, err := saveLogsGNMIGet(ctx, d, &gpb.GetRequest{
+		Path:     []*gpb.Path{{}},
+		Type:     gpb.GetRequest_CONFIG,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	if err != nil {
+		return errors.Wrap(err, "gNMI Get of the running config failed")
+	}
+
+	var data []byte
+	notifs := resp.GetNotification()
+	if len(notifs) == 1 && len(notifs[0].GetUpdate()) == 1 && notifs[0].GetUpdate()[0].GetVal().GetJsonIetfVal() != nil {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, notifs[0].GetUpdate()[0].GetVal().GetJsonIetfVal(), "", "  "); err != nil {
+			return errors.Wrap(err, "failed to format the running config")
+		}
+		data = buf.Bytes()
+	} else {
+		data = []byte(prototext.Format(resp))
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// unhealthyComponents returns the names of the components whose Healthz
+// status is UNHEALTHY.
+func unhealthyComponents(ctx context.Context, d *ondatra.DUTDevice) ([]string, error) {
+	resp, err := saveLogsGNMIGet(ctx, d, &gpb.GetRequest{
+		Path: []*gpb.Path{{
+			Origin: "openconfig",
+			Elem: []*gpb.PathElem{
+				{Name: "components"},
+				{Name: "component", Key: map[string]string{"name": "*"}},
+				{Name: "healthz"},
+				{Name: "state"},
+				{Name: "status"},
+			},
+		}},
+		Type:     gpb.GetRequest_STATE,
+		Encoding: gpb.Encoding_JSON_IETF,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "gNMI Get of the component health failed")
+	}
+
+	var names []string
+	for _, n := range resp.GetNotification() {
+		for _, u := range n.GetUpdate() {
+			var status string
+			if err := json.Unmarshal(u.GetVal().GetJsonIetfVal(), &status); err != nil {
+				continue
+			}
+			if !strings.HasSuffix(status, "UNHEALTHY") {
+				continue
+			}
+			for _, e := range append(append([]*gpb.PathElem(nil), n.GetPrefix().GetElem()...), u.GetPath().GetElem()...) {
+				if e.GetName() == "component" {
+					names = append(names, e.GetKey()["name"])
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
+// saveUnhealthyArtifacts saves the Healthz artifacts of every unhealthy
+// component to a directory per component.
+func saveUnhealthyArtifacts(ctx context.Context, d *ondatra.DUTDevice, dir string) error {
+	names, err := unhealthyComponents(ctx, d)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	client, err := saveLogsHealthzClientGet(ctx, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to dial gNOI")
+	}
+	for _, name := range names {
+		resp, err := client.Get(ctx, &healthzpb.GetRequest{Path: healthzComponentPath(name)})
+		if err != nil {
+			log.Warningf("Healthz Get of component %v failed: %v", name, err)
+			continue
+		}
+		componentDir := filepath.Join(dir, strings.ReplaceAll(name, "/", "_"))
+		if err := os.MkdirAll(componentDir, 0755); err != nil {
+			return errors.Wrapf(err, "failed to create %v", componentDir)
+		}
+		for _, header := range componentArtifacts(resp.GetComponent()) {
+			if _, err := healthzArtifact(client, header, componentDir); err != nil {
+				log.Warningf("Failed to save artifact %v of component %v: %v", header.GetId(), name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// saveSSHCommands saves the output of SaveLogsSSHCommands to a single file.
+func saveSSHCommands(addr, path string) error {
+	var buf bytes.Buffer
+	for _, cmd := range SaveLogsSSHCommands {
+		fmt.Fprintf(&buf, "$ %s\n", cmd)
+		out, err := RunSSH(addr, cmd)
+		if err != nil {
+			fmt.Fprintf(&buf, "error: %v\n", err)
+		}
+		buf.WriteString(out)
+		buf.WriteString("\n")
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,223 @@
+package testhelper
+
+// This file contains the installation of a switch image through gNOI OS.
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/pkg/errors"
+
+	ospb "github.com/openconfig/gnoi/os"
+	syspb "github.com/openconfig/gnoi/system"
+	tpb "github.com/openconfig/gnoi/types"
+)
+
+// osInstallChunkSize is the default size of the image chunks streamed by
+// OSInstall.
+const osInstallChunkSize = 1 << 20
+
+// Function pointers that interact with the switch. They enable unit testing
+// of methods that interact with the switch.
+var (
+	gnoiOSClientGet = func(t *testing.T, d *ondatra.DUTDevice) ospb.OSClient {
+		return d.RawAPIs().GNOI(t).OS()
+	}
+)
+
+// OSInstallParams specify the parameters used by the OSInstall API.
+type OSInstallParams struct {
+	image       string
+	version     string
+	chunkSize   int
+	noReboot    bool
+	rebootParam *RebootParams
+}
+
+// NewOSInstallParams returns OSInstallParams to install the image file with
+// the given version. The switch is cold rebooted into the new version with the
+// default RebootParams.
+func NewOSInstallParams(image, version string) *OSInstallParams {
+	return &OSInstallParams{
+		image:       image,
+		version:     version,
+		chunkSize:   osInstallChunkSize,
+		rebootParam: NewRebootParams().WithRequest(syspb.RebootMethod_COLD),
+	}
+}
+
+// WithChunkSize sets the size of the image chunks streamed to the switch.
+func (p *OSInstallParams) WithChunkSize(size int) *OSInstallParams {
+	p.chunkSize = size
+	return p
+}
+
+// WithRebootParams sets the parameters of the reboot into the new version.
+func (p *OSInstallParams) WithRebootParams(params *RebootParams) *OSInstallParams {
+	p.rebootParam = params
+	return p
+}
+
+// WithNoReboot only activates the new version for the next reboot. The switch
+// keeps running the current version.
+func (p *OSInstallParams) WithNoReboot() *OSInstallParams {
+	p.noReboot = true
+	return p
+}
+
+// OSInstall upgrades the switch to the image of the parameters. It streams the
+// image with gNOI OS.Install unless the switch already has the version, sending
+// the SHA256 of the image for the switch to verify the transfer, and
+// activates the version with OS.Activate without rebooting. It then reboots the
+// switch through Reboot and confirms with OS.Verify that the switch runs the
+// new version.
+func OSInstall(t *testing.T, d *ondatra.DUTDevice, params *OSInstallParams) error {
+	if params.chunkSize <= 0 {
+		return errors.Errorf("invalid chunk size:%v", params.chunkSize)
+	}
+	name := testhelperDUTNameGet(d)
+	if err := osTransfer(gnoiOSClientGet(t, d), name, params); err != nil {
+		return err
+	}
+
+	resp, err := gnoiOSClientGet(t, d).Activate(context.Background(), &ospb.ActivateRequest{Version: params.version, NoReboot: true})
+	if err != nil {
+		return errors.Wrapf(err, "activate RPC failed")
+	}
+	if e := resp.GetActivateError(); e != nil {
+		return errors.Errorf("failed to activate version %v on %v: %v: %v", params.version, name, e.GetType(), e.GetDetail())
+	}
+	log.Infof("Activated version %v on %v", params.version, name)
+	if params.noReboot {
+		return nil
+	}
+
+	if err := Reboot(t, d, params.rebootParam); err != nil {
+		return errors.Wrapf(err, "failed to reboot %v into version %v", name, params.version)
+	}
+	verify, err := gnoiOSClientGet(t, d).Verify(context.Background(), &ospb.VerifyRequest{})
+	if err != nil {
+		return errors.Wrapf(err, "verify RPC failed")
+	}
+	if msg := verify.GetActivationFailMessage(); msg != "" {
+		return errors.Errorf("activation of version %v on %v failed: %v", params.version, name, msg)
+	}
+	if got, want := verify.GetVersion(), params.version; got != want {
+		return errors.Errorf("%v runs version %v after the reboot, want %v", name, got, want)
+	}
+	log.Infof("%v runs version %v", name, params.version)
+	return nil
+}
+
+// imageHash returns the SHA256 of the image file.
+func imageHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open image %v", path)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, errors.Wrapf(err, "failed to read image %v", path)
+	}
+	return h.Sum(nil), nil
+}
+
+// osTransfer streams the image to the switch with OS.Install and waits for the
+// switch to validate it against the hash of the transfer request.
+func osTransfer(client ospb.OSClient, name string, params *OSInstallParams) error {
+	hash, err := imageHash(params.image)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Install(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "install RPC failed")
+	}
+	req := &ospb.TransferRequest{
+		Version: params.version,
+		Hash:    &tpb.HashType{Method: tpb.HashType_SHA256, Hash: hash},
+	}
+	if err := stream.Send(&ospb.InstallRequest{Request: &ospb.InstallRequest_TransferRequest{TransferRequest: req}}); err != nil {
+		return errors.Wrapf(err, "failed to send transfer request")
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return errors.Wrapf(err, "failed to receive transfer response")
+	}
+	switch r := resp.GetResponse().(type) {
+	case *ospb.InstallResponse_TransferReady:
+	case *ospb.InstallResponse_Validated:
+		log.Infof("%v already has version %v, skipping the transfer", name, r.Validated.GetVersion())
+		return validatedVersion(r.Validated, params.version)
+	case *ospb.InstallResponse_InstallError:
+		return installError(r.InstallError, name)
+	default:
+		return errors.Errorf("unexpected install response %v", resp)
+	}
+
+	f, err := os.Open(params.image)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open image %v", params.image)
+	}
+	defer f.Close()
+	buf := make([]byte, params.chunkSize)
+	var sent uint64
+	start := time.Now()
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&ospb.InstallRequest{Request: &ospb.InstallRequest_TransferContent{TransferContent: buf[:n]}}); err != nil {
+				return errors.Wrapf(err, "failed to send image contents after %v bytes", sent)
+			}
+			sent += uint64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to read image %v", params.image)
+		}
+	}
+	if err := stream.Send(&ospb.InstallRequest{Request: &ospb.InstallRequest_TransferEnd{TransferEnd: &ospb.TransferEnd{}}}); err != nil {
+		return errors.Wrapf(err, "failed to send transfer end")
+	}
+	log.Infof("Sent %v bytes of image %v (sha256 %x) to %v in %v", sent, params.image, hash, name, time.Since(start).Round(time.Second))
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return errors.Wrapf(err, "failed to receive install response")
+		}
+		switch r := resp.GetResponse().(type) {
+		case *ospb.InstallResponse_TransferProgress:
+			log.V(1).Infof("%v received %v of %v bytes", name, r.TransferProgress.GetBytesReceived(), sent)
+		case *ospb.InstallResponse_SyncProgress:
+			log.Infof("%v synced %v%% of the image to the standby supervisor", name, r.SyncProgress.GetPercentageTransferred())
+		case *ospb.InstallResponse_Validated:
+			return validatedVersion(r.Validated, params.version)
+		case *ospb.InstallResponse_InstallError:
+			return installError(r.InstallError, name)
+		default:
+			return errors.Errorf("unexpected install response %v", resp)
+		}
+	}
+}
+
+func validatedVersion(v *ospb.Validated, want string) error {
+	if got := v.GetVersion(); got != want {
+		return errors.Errorf("switch validated version %v, want %v", got, want)
+	}
+	return nil
+}
+
+func installError(e *ospb.InstallError, name string) error {
+	return errors.Errorf("failed to install image on %v: %v: %v", name, e.GetType(), e.GetDetail())
+}
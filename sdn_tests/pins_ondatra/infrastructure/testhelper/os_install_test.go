@@ -0,0 +1,92 @@
+package testhelper_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openconfig/ondatra"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/fakebackend"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/pinsbind"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
+
+	syspb "github.com/openconfig/gnoi/system"
+)
+
+var fake = fakebackend.New(fakebackend.WithRebootTime(100 * time.Millisecond))
+
+func TestMain(m *testing.M) {
+	pinsbind.SetBackend(fake)
+	ondatra.RunTests(m, pinsbind.New)
+}
+
+// writeImage writes an image file and returns its path and SHA256.
+func writeImage(t *testing.T, contents []byte) (string, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "image.bin")
+	if err := os.WriteFile(path, contents, 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+	return path, fmt.Sprintf("%x", sha256.Sum256(contents))
+}
+
+func fakeDUT(t *testing.T) *fakebackend.Device {
+	t.Helper()
+	d, err := fake.Device("DUT")
+	if err != nil {
+		t.Fatalf("Device(DUT) failed: %v", err)
+	}
+	return d
+}
+
+func TestOSInstall(t *testing.T) {
+	dut := ondatra.DUT(t, "DUT")
+	image, hash := writeImage(t, bytes.Repeat([]byte("pins"), 1000))
+	const version = "fake-os-2.0"
+
+	rebootParams := testhelper.NewRebootParams().WithRequest(syspb.RebootMethod_COLD).WithWaitTime(10 * time.Second).WithCheckInterval(50 * time.Millisecond)
+	// The small chunks split the image into several transfers.
+	params := testhelper.NewOSInstallParams(image, version).WithChunkSize(1000).WithRebootParams(rebootParams)
+	if err := testhelper.OSInstall(t, dut, params); err != nil {
+		t.Fatalf("OSInstall(%v) failed: %v", version, err)
+	}
+
+	d := fakeDUT(t)
+	if got, ok := d.OSImageHash(version); !ok || got != hash {
+		t.Errorf("SHA256 of the installed image = %q, %v, want %q", got, ok, hash)
+	}
+	if got := d.OSVersion(); got != version {
+		t.Errorf("OS version after OSInstall() = %q, want %q", got, version)
+	}
+}
+
+func TestOSInstallNoReboot(t *testing.T) {
+	dut := ondatra.DUT(t, "DUT")
+	image, hash := writeImage(t, []byte("next image"))
+	const version = "fake-os-3.0"
+	before := fakeDUT(t).OSVersion()
+
+	if err := testhelper.OSInstall(t, dut, testhelper.NewOSInstallParams(image, version).WithNoReboot()); err != nil {
+		t.Fatalf("OSInstall(%v) failed: %v", version, err)
+	}
+
+	d := fakeDUT(t)
+	if got, ok := d.OSImageHash(version); !ok || got != hash {
+		t.Errorf("SHA256 of the installed image = %q, %v, want %q", got, ok, hash)
+	}
+	if got := d.OSVersion(); got != before {
+		t.Errorf("OS version after OSInstall() without reboot = %q, want %q", got, before)
+	}
+}
+
+func TestOSInstallEmptyImage(t *testing.T) {
+	dut := ondatra.DUT(t, "DUT")
+	image, _ := writeImage(t, nil)
+	if err := testhelper.OSInstall(t, dut, testhelper.NewOSInstallParams(image, "fake-os-empty").WithNoReboot()); err == nil {
+		t.Errorf("OSInstall(empty image) succeeded, want an error")
+	}
+}
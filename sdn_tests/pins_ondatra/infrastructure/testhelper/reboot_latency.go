@@ -0,0 +1,143 @@
+package testhelper
+
+// This file contains the latency measurement of the switch reboots.
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/pkg/errors"
+)
+
+// Reboot milestones, in the order they are reached.
+const (
+	MilestoneRPCAccepted     = "rpc_accepted"
+	MilestoneGNOIUnreachable = "gnoi_unreachable"
+	MilestoneGNOIReachable   = "gnoi_reachable"
+	MilestoneGNMIReachable   = "gnmi_reachable"
+	MilestoneBootTimeUpdated = "boot_time_updated"
+	MilestonePortsUp         = "ports_up"
+)
+
+// rebootLatencyFile collects the latency records of the reboots of a test in
+// the test output directory, one JSON record per line.
+const rebootLatencyFile = "reboot_latency.jsonl"
+
+// Function pointers that interact with the switch. They enable unit testing
+// of methods that interact with the switch.
+var (
+	testhelperIntfOperStatusLookup = func(t *testing.T, d *ondatra.DUTDevice, port string) (oc.E_Interface_OperStatus, bool) {
+		return gnmi.Lookup(t, d, gnmi.OC().Interface(port).OperStatus().State()).Val()
+	}
+)
+
+// RebootMilestone is the time a reboot milestone was reached, relative to the
+// reboot request.
+type RebootMilestone struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// RebootLatency is the latency record of a reboot measured by Reboot.
+type RebootLatency struct {
+	TestTrackerID string            `json:"test_tracker_id"`
+	Title         string            `json:"title"`
+	Test          string            `json:"test"`
+	DUT           string            `json:"dut"`
+	Method        string            `json:"method"`
+	Start         time.Time         `json:"start"`
+	Milestones    []RebootMilestone `json:"milestones"`
+	// Completed is false if the reboot did not reach all milestones within
+	// the wait time.
+	Completed bool `json:"completed"`
+
+	upPorts []string
+	reached map[string]bool
+}
+
+// newRebootLatency starts the measurement of a reboot. It records the ports
+// that are up before the reboot, which must be up again for the measurement to
+// complete.
+func newRebootLatency(t *testing.T, d *ondatra.DUTDevice, params *RebootParams, method string) (*RebootLatency, error) {
+	info, err := FetchPortsOperStatus(t, d)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch the ports up before the reboot")
+	}
+	return &RebootLatency{
+		TestTrackerID: params.lmTTkrID,
+		Title:         params.lmTitle,
+		Test:          t.Name(),
+		DUT:           testhelperDUTNameGet(d),
+		Method:        method,
+		upPorts:       info.Up,
+		reached:       map[string]bool{},
+	}, nil
+}
+
+// start sets the time of the reboot request.
+func (l *RebootLatency) start() {
+	if l != nil {
+		l.Start = time.Now()
+	}
+}
+
+// reach records the milestone the first time it is reached.
+func (l *RebootLatency) reach(milestone string) {
+	if l == nil || l.reached[milestone] {
+		return
+	}
+	l.reached[milestone] = true
+	latency := time.Since(l.Start)
+	l.Milestones = append(l.Milestones, RebootMilestone{Name: milestone, Seconds: latency.Seconds()})
+	log.Infof("Reboot of %v reached %v after %v", l.DUT, milestone, latency.Round(time.Millisecond))
+}
+
+func (l *RebootLatency) hasReached(milestone string) bool {
+	return l != nil && l.reached[milestone]
+}
+
+// portsUp returns whether all the ports that were up before the reboot are up
+// again.
+func (l *RebootLatency) portsUp(t *testing.T, d *ondatra.DUTDevice) bool {
+	for _, port := range l.upPorts {
+		if status, ok := testhelperIntfOperStatusLookup(t, d, port); !ok || status != oc.Interface_OperStatus_UP {
+			return false
+		}
+	}
+	return true
+}
+
+// write appends the record to the reboot latency file of the test.
+func (l *RebootLatency) write(t *testing.T, completed bool) {
+	if l == nil {
+		return
+	}
+	l.Completed = completed
+	data, err := json.Marshal(l)
+	if err != nil {
+		log.Warningf("Failed to marshal reboot latency of %v: %v", l.DUT, err)
+		return
+	}
+	log.Infof("Reboot latency: %s", data)
+	dir, err := testOutputDir(t)
+	if err != nil {
+		log.Warningf("Reboot latency of %v is not saved: %v", l.DUT, err)
+		return
+	}
+	path := filepath.Join(dir, rebootLatencyFile)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Warningf("Failed to open %v: %v", path, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Warningf("Failed to write reboot latency to %v: %v", path, err)
+	}
+}
@@ -0,0 +1,286 @@
+package testhelper
+
+// This file contains the reboots followed through gNOI RebootStatus.
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/openconfig/ondatra/gnmi/oc"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	syspb "github.com/openconfig/gnoi/system"
+)
+
+// RebootPostConditions are the conditions that RebootWithStatus verifies once
+// the reboot is over.
+type RebootPostConditions struct {
+	// BootTimeChanged requires the boot time to be after the reboot request if
+	// true, and to be preserved if false.
+	BootTimeChanged bool
+	// PortsStable requires the ports that were up before the reboot to never
+	// go down during the reboot.
+	PortsStable bool
+}
+
+// rebootPostConditions are the post-conditions of the reboot methods that
+// keep the switch forwarding. The other methods only change the boot time.
+var rebootPostConditions = map[syspb.RebootMethod]RebootPostConditions{
+	// A warm reboot restarts the switch software while the forwarding
+	// continues.
+	syspb.RebootMethod_WARM: {BootTimeChanged: true, PortsStable: true},
+	// A non-stop forwarding reboot restarts the control plane only.
+	syspb.RebootMethod_NSF: {BootTimeChanged: false, PortsStable: true},
+}
+
+// Function pointers that interact with the switch. They enable unit testing
+// of methods that interact with the switch.
+var (
+	testhelperRebootStatusGet = func(t *testing.T, d *ondatra.DUTDevice) (*syspb.RebootStatusResponse, error) {
+		return gnoiSystemClientGet(t, d).RebootStatus(context.Background(), &syspb.RebootStatusRequest{})
+	}
+
+	testhelperIntfLastChangeLookup = func(t *testing.T, d *ondatra.DUTDevice, port string) (uint64, bool) {
+		return gnmi.Lookup(t, d, gnmi.OC().Interface(port).LastChange().State()).Val()
+	}
+)
+
+// rebootState is the state of the switch before a reboot, which the
+// post-conditions of the reboot are checked against.
+type rebootState struct {
+	requestTime time.Time
+	bootTime    uint64
+	// lastChanges are the last oper status changes of the ports that are up.
+	lastChanges map[string]uint64
+}
+
+// postConditionsFor returns the post-conditions of the reboot method, unless
+// they are overridden by WithPostConditions.
+func (p *RebootParams) postConditionsFor(method syspb.RebootMethod) RebootPostConditions {
+	if p.postConditions != nil {
+		return *p.postConditions
+	}
+	if c, ok := rebootPostConditions[method]; ok {
+		return c
+	}
+	return RebootPostConditions{BootTimeChanged: true}
+}
+
+// CancelReboot cancels the pending reboot of the switch, e.g. a reboot delayed
+// with RebootParams.WithDelay.
+func CancelReboot(t *testing.T, d *ondatra.DUTDevice, message string) error {
+	if _, err := gnoiSystemClientGet(t, d).CancelReboot(context.Background(), &syspb.CancelRebootRequest{Message: message}); err != nil {
+		return errors.Wrapf(err, "cancel reboot RPC failed")
+	}
+	return nil
+}
+
+// RebootWithStatus sends a RebootRequest message to the switch and follows the
+// reboot through gNOI RebootStatus. The reboot is successful if RebootStatus
+// reports that it is over within the wait time, the gNMI server is up and the
+// post-conditions of the reboot method hold, see RebootPostConditions: e.g. a
+// WARM reboot must not flap the ports that were up. It falls back to Reboot if
+// the switch does not implement RebootStatus and the reboot method only
+// requires the boot time to change.
+func RebootWithStatus(t *testing.T, d *ondatra.DUTDevice, params *RebootParams) error {
+	if params.waitTime < params.checkInterval {
+		return errors.Errorf("wait time:%v cannot be less than check interval:%v", params.waitTime, params.checkInterval)
+	}
+	req, err := params.rebootRequest()
+	if err != nil {
+		return err
+	}
+	name := testhelperDUTNameGet(d)
+	cond := params.postConditionsFor(req.GetMethod())
+
+	resp, err := testhelperRebootStatusGet(t, d)
+	if status.Code(err) == codes.Unimplemented {
+		if !cond.BootTimeChanged || cond.PortsStable {
+			return errors.Errorf("%v reboot of %v cannot be verified without RebootStatus", req.GetMethod(), name)
+		}
+		log.Infof("RebootStatus is not implemented by %v, polling the switch instead", name)
+		return Reboot(t, d, params)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "RebootStatus RPC failed")
+	}
+	if resp.GetActive() {
+		return errors.Errorf("%v already has an active reboot: %v", name, resp.GetReason())
+	}
+
+	if params.captureConsole {
+		// Missing console access must not fail the reboot.
+		capture, err := CaptureConsole(t, d)
+		if err != nil {
+			log.Warningf("Console of %v is not captured: %v", name, err)
+		} else {
+			defer capture.Stop()
+		}
+	}
+
+	before := rebootState{bootTime: gnmiSystemBootTimeGet(t, d)}
+	if cond.PortsStable {
+		if before.lastChanges, err = upPortsLastChange(t, d); err != nil {
+			return err
+		}
+	}
+	var latency *RebootLatency
+	if params.measureLatency() {
+		if latency, err = newRebootLatency(t, d, params, req.GetMethod().String()); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Rebooting %v switch", name)
+	before.requestTime = time.Now()
+	latency.start()
+	if _, err := gnoiSystemClientGet(t, d).Reboot(context.Background(), req); err != nil {
+		return errors.Wrapf(err, "reboot RPC failed")
+	}
+	latency.reach(MilestoneRPCAccepted)
+
+	if params.waitTime == 0 {
+		// User did not request a wait time which implies that the API did not verify whether
+		// the switch has rebooted or not. Therefore, do not return an error in this case.
+		return nil
+	}
+
+	if err := waitRebootStatus(t, d, params, cond, before, latency); err != nil {
+		latency.write(t, false)
+		return err
+	}
+	if err := verifyRebootPostConditions(t, d, cond, before); err != nil {
+		latency.write(t, false)
+		return err
+	}
+	latency.write(t, latency.hasReached(MilestonePortsUp))
+	log.Infof("Switch %v rebooted after %v", name, time.Since(before.requestTime).Round(time.Second))
+	return nil
+}
+
+// waitRebootStatus polls RebootStatus until the reboot is over, then waits for
+// the gNMI server and for the boot time to change if the reboot method changes
+// it. When the latency is measured, it also waits, within the wait time, for
+// the ports that were up before the reboot. Ports still down do not fail the
+// reboot.
+func waitRebootStatus(t *testing.T, d *ondatra.DUTDevice, params *RebootParams, cond RebootPostConditions, before rebootState, latency *RebootLatency) error {
+	name := testhelperDUTNameGet(d)
+	checkInterval := params.checkInterval
+
+	// The reboot is active right after the request. It is over once it has
+	// been seen active or the gNOI server down, and is no longer active.
+	seen, over, ready := false, false, false
+	log.Infof("Polling RebootStatus in %v intervals for max duration of %v", checkInterval, params.delay+params.waitTime)
+	for timeout := before.requestTime.Add(params.delay + params.waitTime); time.Now().Before(timeout); time.Sleep(checkInterval) {
+		timeElapsed := time.Since(before.requestTime).Round(time.Second)
+		if !over {
+			resp, err := testhelperRebootStatusGet(t, d)
+			switch {
+			case err != nil:
+				seen = true
+				latency.reach(MilestoneGNOIUnreachable)
+				log.Infof("gNOI server not up after %v: %v", timeElapsed, err)
+				continue
+			case resp.GetActive():
+				seen = true
+				log.Infof("Reboot of %v scheduled at %v still active after %v: %v", name, time.Unix(0, int64(resp.GetWhen())), timeElapsed, resp.GetReason())
+				continue
+			case !seen:
+				return errors.Errorf("RebootStatus of %v reports no active reboot after the reboot request", name)
+			}
+			if latency.hasReached(MilestoneGNOIUnreachable) {
+				latency.reach(MilestoneGNOIReachable)
+			}
+			if s := resp.GetStatus(); s.GetStatus() == syspb.RebootStatus_STATUS_FAILURE || s.GetStatus() == syspb.RebootStatus_STATUS_RETRIABLE_FAILURE {
+				return errors.Errorf("reboot of %v failed with %v: %v", name, s.GetStatus(), s.GetMessage())
+			}
+			over = true
+			log.Infof("Reboot of %v is over after %v", name, timeElapsed)
+		}
+
+		if !ready {
+			if err := GNMIAble(t, d); err != nil {
+				log.Infof("gNMI server not up after %v", timeElapsed)
+				continue
+			}
+			latency.reach(MilestoneGNMIReachable)
+
+			if cond.BootTimeChanged {
+				if bootTime := gnmiSystemBootTimeGet(t, d); bootTime < uint64(before.requestTime.UnixNano()) {
+					log.Infof("Boot time of %v not updated after %v", name, timeElapsed)
+					continue
+				}
+				latency.reach(MilestoneBootTimeUpdated)
+			}
+			if latency == nil {
+				return nil
+			}
+			ready = true
+		}
+
+		if !latency.portsUp(t, d) {
+			log.Infof("Ports up before the reboot are not up after %v", timeElapsed)
+			continue
+		}
+		latency.reach(MilestonePortsUp)
+		return nil
+	}
+	if ready {
+		log.Warningf("Ports of %v up before the reboot are not all up after %v, the reboot latency is incomplete", name, params.delay+params.waitTime)
+		return nil
+	}
+	return errors.Errorf("failed to reboot %v", name)
+}
+
+// verifyRebootPostConditions verifies that the boot time is preserved if the
+// reboot method preserves it, and that the ports that were up before the
+// reboot did not change their oper status since.
+func verifyRebootPostConditions(t *testing.T, d *ondatra.DUTDevice, cond RebootPostConditions, before rebootState) error {
+	name := testhelperDUTNameGet(d)
+	if !cond.BootTimeChanged {
+		if bootTime := gnmiSystemBootTimeGet(t, d); bootTime != before.bootTime {
+			return errors.Errorf("boot time of %v changed from %v to %v, want it preserved", name, before.bootTime, bootTime)
+		}
+	}
+
+	var flapped []string
+	for port, lastChange := range before.lastChanges {
+		operStatus, ok := testhelperIntfOperStatusLookup(t, d, port)
+		if !ok || operStatus != oc.Interface_OperStatus_UP {
+			flapped = append(flapped, port)
+			continue
+		}
+		if got, ok := testhelperIntfLastChangeLookup(t, d, port); !ok || got != lastChange {
+			flapped = append(flapped, port)
+		}
+	}
+	if len(flapped) > 0 {
+		sort.Strings(flapped)
+		return errors.Errorf("ports of %v went down during the reboot: %v", name, flapped)
+	}
+	return nil
+}
+
+// upPortsLastChange returns the last oper status change of the ports that are
+// up.
+func upPortsLastChange(t *testing.T, d *ondatra.DUTDevice) (map[string]uint64, error) {
+	info, err := FetchPortsOperStatus(t, d)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch the ports up before the reboot")
+	}
+	lastChanges := make(map[string]uint64, len(info.Up))
+	for _, port := range info.Up {
+		lastChange, ok := testhelperIntfLastChangeLookup(t, d, port)
+		if !ok {
+			return nil, errors.Errorf("last change of port %v is not available", port)
+		}
+		lastChanges[port] = lastChange
+	}
+	return lastChanges, nil
+}
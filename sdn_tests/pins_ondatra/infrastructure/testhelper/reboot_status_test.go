@@ -0,0 +1,100 @@
+package testhelper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openconfig/ondatra"
+	"github.com/openconfig/ondatra/gnmi"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
+
+	syspb "github.com/openconfig/gnoi/system"
+)
+
+func bootTime(t *testing.T, dut *ondatra.DUTDevice) uint64 {
+	t.Helper()
+	return gnmi.Get(t, dut, gnmi.OC().System().BootTime().State())
+}
+
+func TestRebootWithStatus(t *testing.T) {
+	tests := []struct {
+		desc   string
+		method syspb.RebootMethod
+		// cond overrides the post-conditions of the method if set.
+		cond             *testhelper.RebootPostConditions
+		wantErr          bool
+		wantBootTimeSame bool
+	}{{
+		desc:   "COLD",
+		method: syspb.RebootMethod_COLD,
+	}, {
+		desc:   "WARM keeps the ports up",
+		method: syspb.RebootMethod_WARM,
+	}, {
+		desc:             "NSF preserves the boot time",
+		method:           syspb.RebootMethod_NSF,
+		wantBootTimeSame: true,
+	}, {
+		desc:    "COLD flapping the ports that must stay up",
+		method:  syspb.RebootMethod_COLD,
+		cond:    &testhelper.RebootPostConditions{BootTimeChanged: true, PortsStable: true},
+		wantErr: true,
+	}, {
+		desc:    "WARM changing the boot time that must be preserved",
+		method:  syspb.RebootMethod_WARM,
+		cond:    &testhelper.RebootPostConditions{BootTimeChanged: false, PortsStable: true},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			dut := ondatra.DUT(t, "DUT")
+			before := bootTime(t, dut)
+
+			params := testhelper.NewRebootParams().WithRequest(tt.method).WithWaitTime(10 * time.Second).WithCheckInterval(50 * time.Millisecond)
+			if tt.cond != nil {
+				params = params.WithPostConditions(*tt.cond)
+			}
+			err := testhelper.RebootWithStatus(t, dut, params)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("RebootWithStatus(%v) = %v, want error: %v", tt.method, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if after := bootTime(t, dut); (after == before) != tt.wantBootTimeSame {
+				t.Errorf("Boot time after the %v reboot = %v, before = %v, want it preserved: %v", tt.method, after, before, tt.wantBootTimeSame)
+			}
+		})
+	}
+}
+
+func TestCancelReboot(t *testing.T) {
+	dut := ondatra.DUT(t, "DUT")
+	before := bootTime(t, dut)
+
+	// Without a wait time, RebootWithStatus returns once the reboot is
+	// scheduled.
+	params := testhelper.NewRebootParams().WithRequest(syspb.RebootMethod_COLD).WithDelay(time.Minute).WithWaitTime(0).WithCheckInterval(0)
+	if err := testhelper.RebootWithStatus(t, dut, params); err != nil {
+		t.Fatalf("RebootWithStatus(delayed) failed: %v", err)
+	}
+	if err := testhelper.CancelReboot(t, dut, "test"); err != nil {
+		t.Fatalf("CancelReboot() failed: %v", err)
+	}
+
+	resp, err := dut.RawAPIs().GNOI(t).System().RebootStatus(context.Background(), &syspb.RebootStatusRequest{})
+	if err != nil {
+		t.Fatalf("RebootStatus() failed: %v", err)
+	}
+	if resp.GetActive() {
+		t.Errorf("RebootStatus().Active after CancelReboot() = true, want false")
+	}
+	if err := testhelper.CancelReboot(t, dut, "test"); err == nil {
+		t.Errorf("CancelReboot() without a pending reboot succeeded, want an error")
+	}
+	if after := bootTime(t, dut); after != before {
+		t.Errorf("Boot time after the cancelled reboot = %v, want %v", after, before)
+	}
+}
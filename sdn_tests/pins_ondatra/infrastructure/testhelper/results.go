@@ -1,14 +1,372 @@
 package testhelper
 
 import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/pkg/errors"
+)
+
+// Result files aggregating the results of all the tests of the test binary,
+// written to the Bazel undeclared outputs directory, or a directory unique to
+// the run outside of Bazel.
+const (
+	resultsJSONFile  = "test_results.json"
+	resultsJUnitFile = "test_results.xml"
 )
 
-// Teardown performs the teardown routine after the test completion.
+// Test statuses of a TestResult.
+const (
+	TestPassed  = "PASS"
+	TestFailed  = "FAIL"
+	TestSkipped = "SKIP"
+)
+
+// TestResult is the result of a test recorded by Teardown.
+type TestResult struct {
+	Name      string    `json:"name"`
+	IDs       []string  `json:"ids,omitempty"`
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"start_time"`
+	Duration  float64   `json:"duration_secs"`
+	DUTName   string    `json:"dut_name,omitempty"`
+	DUTVendor string    `json:"dut_vendor,omitempty"`
+	// Failure holds the log of a failed test, which contains its failure
+	// messages.
+	Failure string `json:"failure,omitempty"`
+}
+
+var (
+	resultsMu sync.Mutex
+	results   []*TestResult
+)
+
+// unreportedFailure is the failure of a test whose output was not captured.
+const unreportedFailure = "test failed, see the test log for the failure messages"
+
+// resultsDirty is set when failures parsed from the test output changed the
+// results after the result files were written.
+var resultsDirty bool
+
+// The testing package does not expose the log of a test, so the log and
+// failure messages of the failed tests are parsed from its output instead.
+// CaptureTestOutput forwards the standard output through the parser.
+var (
+	captureMu   sync.Mutex
+	stopCapture func()
+	logs        = &testLogs{lines: map[string][]string{}}
+)
+
+// CaptureTestOutput parses the standard output of the test binary to record
+// the log of the failed tests, i.e. their t.Logf, t.Errorf and t.Fatalf
+// messages, in their results. It must be called before the tests run, e.g. by
+// the binding, and the returned function restores the standard output once
+// they completed. The output is written through unchanged.
+func CaptureTestOutput() (func(), error) {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	if stopCapture != nil {
+		return func() {}, nil
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the test output pipe")
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(io.TeeReader(r, stdout))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			parseTestOutput(scanner.Text())
+		}
+		// Keep forwarding the output if a line is too long to be parsed.
+		io.Copy(stdout, r)
+		r.Close()
+		resultsMu.Lock()
+		defer resultsMu.Unlock()
+		if !resultsDirty {
+			return
+		}
+		if err := writeResults(); err != nil {
+			log.Warningf("Failed to record the logs of the failed tests: %v", err)
+		}
+	}()
+	stopCapture = func() {
+		os.Stdout = stdout
+		w.Close()
+		<-done
+	}
+	return func() {
+		captureMu.Lock()
+		defer captureMu.Unlock()
+		if stopCapture != nil {
+			stopCapture()
+			stopCapture = nil
+		}
+	}, nil
+}
+
+// parseTestOutput parses a line of the test output and updates the result of
+// the failed test it belongs to. The result files are rewritten once the log
+// of the test is complete, i.e. on the next line of another test.
+func parseTestOutput(line string) {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	name := logs.parse(line)
+	updated := false
+	if name != "" {
+		for _, r := range results {
+			if r.Name == name && r.Status == TestFailed {
+				r.Failure = logs.log(name)
+				updated = true
+			}
+		}
+	}
+	if updated {
+		resultsDirty = true
+		return
+	}
+	if resultsDirty {
+		if err := writeResults(); err != nil {
+			log.Warningf("Failed to record the logs of the failed tests: %v", err)
+		}
+	}
+}
+
+// testLogs holds the log lines of the tests parsed from the output of the
+// testing package until the tests passed or were skipped. With -test.v, the
+// log of a test follows the "=== RUN", "=== CONT" or "=== NAME" line naming
+// it. Otherwise it is indented below the "--- FAIL" line of the test, which
+// is indented below the line of its parent test.
+type testLogs struct {
+	// current is the test named by the last "=== RUN" line.
+	current string
+	// headers are the result lines enclosing the current line, from the
+	// outermost test.
+	headers []logHeader
+	lines   map[string][]string
+}
+
+type logHeader struct {
+	indent int
+	name   string
+}
+
+var (
+	runLine    = regexp.MustCompile(`^=== (?:RUN|CONT|NAME) +(\S+)`)
+	resultLine = regexp.MustCompile(`^--- (FAIL|PASS|SKIP): (\S+) \(`)
+)
+
+// parse parses a line of output and returns the test whose log it extends, or
+// the failed test it reports.
+func (l *testLogs) parse(line string) string {
+	// The output of -test.v=test2json marks the lines of the testing package.
+	line = strings.TrimPrefix(line, "\x16")
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	if trimmed == "" {
+		return ""
+	}
+	if m := runLine.FindStringSubmatch(trimmed); m != nil && indent == 0 {
+		l.current, l.headers = m[1], nil
+		return ""
+	}
+	for n := len(l.headers); n > 0 && l.headers[n-1].indent >= indent; n-- {
+		l.headers = l.headers[:n-1]
+	}
+	if m := resultLine.FindStringSubmatch(trimmed); m != nil {
+		l.headers = append(l.headers, logHeader{indent: indent, name: m[2]})
+		if m[1] != TestFailed {
+			delete(l.lines, m[2])
+			return ""
+		}
+		return m[2]
+	}
+	if indent == 0 {
+		// Other unindented lines, e.g. "FAIL" or prints of the test, are not
+		// part of a test log.
+		return ""
+	}
+	name, base := l.current, 4
+	if n := len(l.headers); n > 0 {
+		name, base = l.headers[n-1].name, l.headers[n-1].indent+4
+	}
+	if name == "" {
+		return ""
+	}
+	// Continuation lines keep their indent relative to the first line.
+	l.lines[name] = append(l.lines[name], line[min(indent, base):])
+	return name
+}
+
+// log returns the log of the test.
+func (l *testLogs) log(name string) string {
+	return strings.Join(l.lines[name], "\n")
+}
+
+// Teardown performs the teardown routine after the test completion. It saves
+// the switch logs if the test failed, restores the config captured by
+// WithConfigRestore and records the result of the test. A failed restore
+// fails the test.
 func (o TearDownOptions) Teardown(t *testing.T) {
+	end := time.Now()
+	defer func() {
+		if err := recordResult(o.result(t, end)); err != nil {
+			log.Warningf("Failed to record result of %v: %v", t.Name(), err)
+		}
+	}()
 	if t.Failed() {
 		if o.SaveLogs != nil {
 			o.SaveLogs(t, t.Name()+"_log", o.DUTDeviceInfo, o.DUTPeerDeviceInfo)
 		}
 	}
+	for _, s := range o.configSnapshots {
+		if err := restoreConfig(t, s); err != nil {
+			t.Errorf("Failed to restore the config captured at the start of the test, the switch may be left dirty: %v", err)
+		}
+	}
+}
+
+func (o TearDownOptions) result(t *testing.T, end time.Time) *TestResult {
+	r := &TestResult{
+		Name:      t.Name(),
+		IDs:       o.IDs,
+		Status:    TestPassed,
+		StartTime: o.StartTime,
+		Duration:  end.Sub(o.StartTime).Seconds(),
+		DUTName:   o.DUTDeviceInfo.name,
+	}
+	if o.DUTDeviceInfo.name != "" {
+		r.DUTVendor = o.DUTDeviceInfo.vendor.String()
+	}
+	switch {
+	case t.Failed():
+		r.Status = TestFailed
+		r.Failure = unreportedFailure
+	case t.Skipped():
+		r.Status = TestSkipped
+	}
+	return r
+}
+
+// recordResult adds the result to the results of the test binary and rewrites
+// the result files, so that they are complete even if a later test crashes.
+func recordResult(r *TestResult) error {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	if l := logs.log(r.Name); r.Status == TestFailed && l != "" {
+		r.Failure = l
+	}
+	results = append(results, r)
+	return writeResults()
+}
+
+// writeResults writes the result files. The caller must hold resultsMu.
+func writeResults() error {
+	resultsDirty = false
+	base := testOutputsBase()
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal test results")
+	}
+	if err := os.WriteFile(filepath.Join(base, resultsJSONFile), data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write test results")
+	}
+	data, err = junitResults(results)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(base, resultsJUnitFile), data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write JUnit test results")
+	}
+	return nil
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	Skipped    *struct{}       `xml:"skipped,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitResults returns the results as a JUnit XML test suite. The test IDs
+// and the DUT are reported as properties of the test cases.
+func junitResults(results []*TestResult) ([]byte, error) {
+	suite := junitTestSuite{
+		Name:  filepath.Base(os.Args[0]),
+		Tests: len(results),
+	}
+	var total float64
+	for _, r := range results {
+		tc := junitTestCase{
+			Name:      r.Name,
+			ClassName: suite.Name,
+			Time:      fmt.Sprintf("%.3f", r.Duration),
+		}
+		for _, id := range r.IDs {
+			tc.Properties = append(tc.Properties, junitProperty{Name: "id", Value: id})
+		}
+		if r.DUTName != "" {
+			tc.Properties = append(tc.Properties,
+				junitProperty{Name: "dut_name", Value: r.DUTName},
+				junitProperty{Name: "dut_vendor", Value: r.DUTVendor})
+		}
+		switch r.Status {
+		case TestFailed:
+			suite.Failures++
+			message, _, _ := strings.Cut(r.Failure, "\n")
+			tc.Failure = &junitFailure{Message: strings.TrimSpace(message), Contents: r.Failure}
+		case TestSkipped:
+			suite.Skipped++
+			tc.Skipped = &struct{}{}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+		total += r.Duration
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+	if len(results) > 0 {
+		suite.Timestamp = results[0].StartTime.Format(time.RFC3339)
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal JUnit test results")
+	}
+	return append([]byte(xml.Header), data...), nil
 }
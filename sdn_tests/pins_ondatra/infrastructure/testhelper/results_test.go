@@ -0,0 +1,73 @@
+package testhelper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTestLogs(t *testing.T) {
+	tests := []struct {
+		desc   string
+		output string
+	}{{
+		desc: "buffered output",
+		output: `--- FAIL: TestA (0.00s)
+    s_test.go:6: parent log
+    --- FAIL: TestA/sub (0.00s)
+        s_test.go:8: sub failed
+            second line
+    s_test.go:11: parent failed
+--- FAIL: TestC (0.00s)
+    s_test.go:16: c fatal
+FAIL
+FAIL	sample	0.002s
+`,
+	}, {
+		desc: "-test.v output",
+		output: `=== RUN   TestA
+    s_test.go:6: parent log
+=== RUN   TestA/sub
+    s_test.go:8: sub failed
+        second line
+=== RUN   TestA/ok
+    s_test.go:10: passing log
+=== NAME  TestA
+    s_test.go:11: parent failed
+--- FAIL: TestA (0.00s)
+    --- FAIL: TestA/sub (0.00s)
+    --- PASS: TestA/ok (0.00s)
+=== RUN   TestB
+    s_test.go:14: b log
+--- PASS: TestB (0.00s)
+=== RUN   TestC
+    s_test.go:16: c fatal
+--- FAIL: TestC (0.00s)
+FAIL
+FAIL	sample	0.002s
+`,
+	}}
+	want := map[string]string{
+		"TestA":     "s_test.go:6: parent log\ns_test.go:11: parent failed",
+		"TestA/sub": "s_test.go:8: sub failed\n    second line",
+		"TestC":     "s_test.go:16: c fatal",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			l := &testLogs{lines: map[string][]string{}}
+			for _, line := range strings.Split(tt.output, "\n") {
+				l.parse(line)
+			}
+			// The logs of the passed tests are dropped.
+			got := map[string]string{}
+			for name := range l.lines {
+				got[name] = l.log(name)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Logs of the failed tests differ (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
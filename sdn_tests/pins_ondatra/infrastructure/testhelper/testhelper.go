@@ -5,7 +5,10 @@ import (
 	"crypto/rand"
 	"math/big"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -120,6 +123,15 @@ var (
 		return DUTInfo{}
 	}
 
+	testhelperDUTByNameGet = func(t *testing.T, name string) (*ondatra.DUTDevice, error) {
+		for _, d := range ondatra.DUTs(t) {
+			if d.Name() == name {
+				return d, nil
+			}
+		}
+		return nil, errors.Errorf("switch %v is not reserved", name)
+	}
+
 	teardownDUTHealthzGet = func(t *testing.T) healthzpb.HealthzClient {
 		return ondatra.DUT(t, "DUT").RawAPIs().GNOI(t).Healthz()
 	}
@@ -207,15 +219,34 @@ type TearDownOptions struct {
 	DUTDeviceInfo     DUTInfo
 	DUTPeerDeviceInfo DUTInfo
 	SaveLogs          func(t *testing.T, savePrefix string, dut, peer DUTInfo)
+	// configSnapshots are restored by Teardown, see WithConfigRestore.
+	configSnapshots []configSnapshot
 }
 
-// NewTearDownOptions creates the TearDownOptions structure with default values.
+// TestHook is called by NewTearDownOptions when a test starts. dir is the
+// output directory of the test, or empty if it could not be created.
+type TestHook func(t *testing.T, dir string)
+
+var testHooks []TestHook
+
+// RegisterTestHook registers a hook called at the start of every test, e.g. by
+// the binding to attribute its gRPC traffic to the test. It must be called from
+// an init function.
+func RegisterTestHook(hook TestHook) {
+	testHooks = append(testHooks, hook)
+}
+
+// NewTearDownOptions creates the TearDownOptions structure with default values
+// and runs the registered test hooks. The switch logs are saved with
+// SaveSwitchLogs if the test fails.
 func NewTearDownOptions(t *testing.T) TearDownOptions {
+	runTestHooks(t)
 	return TearDownOptions{
 		StartTime:         time.Now(),
 		DUTName:           teardownDUTNameGet(t),
 		DUTDeviceInfo:     teardownDUTDeviceInfoGet(t),
 		DUTPeerDeviceInfo: teardownDUTPeerDeviceInfoGet(t),
+		SaveLogs:          SaveSwitchLogs,
 	}
 }
 
@@ -384,6 +415,57 @@ func WrapError(err error, format string, args ...any) error {
 	return errors.Wrapf(err, format, args...)
 }
 
+var (
+	outputsBaseOnce sync.Once
+	outputsBase     string
+)
+
+// testOutputsBase returns the Bazel undeclared outputs directory. Outside of
+// Bazel, it returns a new directory below the temp directory, so that runs do
+// not overwrite each other's outputs.
+func testOutputsBase() string {
+	if base := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"); base != "" {
+		return base
+	}
+	outputsBaseOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "pins_ondatra_outputs_")
+		if err != nil {
+			log.Warningf("Failed to create the test outputs directory, using %v: %v", os.TempDir(), err)
+			dir = os.TempDir()
+		}
+		log.Infof("Writing the test outputs to %v", dir)
+		outputsBase = dir
+	})
+	return outputsBase
+}
+
+// runTestHooks runs the registered test hooks with the output directory of
+// the test.
+func runTestHooks(t *testing.T) {
+	if len(testHooks) == 0 {
+		return
+	}
+	dir, err := testOutputDir(t)
+	if err != nil {
+		log.Warningf("Output directory of %v is not available to the test hooks: %v", t.Name(), err)
+		dir = ""
+	}
+	for _, hook := range testHooks {
+		hook(t, dir)
+	}
+}
+
+// testOutputDir returns the directory collecting the outputs of the test,
+// e.g. console captures. It is created below the Bazel undeclared outputs
+// directory, or the temp directory when running outside of Bazel.
+func testOutputDir(t *testing.T) (string, error) {
+	dir := filepath.Join(testOutputsBase(), strings.ReplaceAll(t.Name(), "/", "_"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrapf(err, "failed to create test output directory %v", dir)
+	}
+	return dir, nil
+}
+
 // DUTPortNames returns the port names of the DUT.
 func DUTPortNames(dut *ondatra.DUTDevice) []string {
 	var portNames []string
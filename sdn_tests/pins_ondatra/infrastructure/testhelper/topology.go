@@ -0,0 +1,73 @@
+package testhelper
+
+// This file contains helper methods to navigate the cabling between the
+// reserved devices.
+import (
+	"testing"
+
+	"github.com/openconfig/ondatra"
+	"github.com/pkg/errors"
+)
+
+// linkedDUT is implemented by bindings that know how the reserved ports are
+// cabled.
+type linkedDUT interface {
+	HasLinks() bool
+	PeerPort(portID string) (device string, port string, ok bool)
+}
+
+// errNoLinks reports a reservation without cabling information.
+var errNoLinks = errors.New("reservation does not provide links")
+
+// Function pointers that interact with the switch. They enable unit testing
+// of methods that interact with the switch.
+var (
+	testhelperPeerPortIDGet = func(d *ondatra.DUTDevice, portID string) (string, string, error) {
+		l, ok := d.RawAPIs().BindingDUT().(linkedDUT)
+		if !ok || !l.HasLinks() {
+			return "", "", errors.Wrapf(errNoLinks, "binding of %v", d.Name())
+		}
+		device, port, ok := l.PeerPort(portID)
+		if !ok {
+			return "", "", errors.Errorf("port %v of %v is not linked to a reserved port", portID, d.Name())
+		}
+		return device, port, nil
+	}
+
+	testhelperDeviceGet = func(t *testing.T, id string) (*ondatra.Device, error) {
+		if d, ok := ondatra.DUTs(t)[id]; ok {
+			return d.Device, nil
+		}
+		if a, ok := ondatra.ATEs(t)[id]; ok {
+			return a.Device, nil
+		}
+		return nil, errors.Errorf("device %v is not reserved", id)
+	}
+)
+
+// PeerPort returns the device and port at the far end of the link connected to
+// the given port of the DUT. The port is the interface name, e.g.
+// "Ethernet1/1/1".
+func PeerPort(t *testing.T, dut *ondatra.DUTDevice, port string) (*ondatra.Device, *ondatra.Port, error) {
+	t.Helper()
+	var portID string
+	for _, p := range testhelperDUTPortsGet(dut) {
+		if testhelperOndatraPortNameGet(p) == port {
+			portID = testhelperOndatraPortIDGet(p)
+			break
+		}
+	}
+	if portID == "" {
+		return nil, nil, errors.Errorf("port %v is not reserved on %v", port, testhelperDUTNameGet(dut))
+	}
+
+	deviceID, peerPortID, err := testhelperPeerPortIDGet(dut, portID)
+	if err != nil {
+		return nil, nil, err
+	}
+	peer, err := testhelperDeviceGet(t, deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return peer, peer.Port(t, peerPortID), nil
+}
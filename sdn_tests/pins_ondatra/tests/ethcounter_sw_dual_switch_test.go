@@ -56,15 +56,14 @@ const (
 // controlPortLinkedToDutPort returns port on control switch that is connected to given port on DUT.
 func controlPortLinkedToDUTPort(t *testing.T, dut *ondatra.DUTDevice, control *ondatra.DUTDevice, dutPort string) (string, error) {
 	t.Helper()
-	for _, port := range dut.Ports() {
-		if port.Name() == dutPort {
-			if control.Port(t, port.ID()) == nil {
-				return "", errors.Errorf("control port corresponding to dutPort %v not found", dutPort)
-			}
-			return control.Port(t, port.ID()).Name(), nil
-		}
+	peer, port, err := testhelper.PeerPort(t, dut, dutPort)
+	if err != nil {
+		return "", errors.Wrapf(err, "control port corresponding to dutPort %v not found", dutPort)
+	}
+	if peer.ID() != control.ID() {
+		return "", errors.Errorf("dutPort %v is linked to %v instead of control switch", dutPort, peer.Name())
 	}
-	return "", errors.Errorf("control port corresponding to dutPort %v not found", dutPort)
+	return port.Name(), nil
 }
 
 // checkInitial validates preconditions before test starts.
@@ -12,6 +12,7 @@ import (
 	"github.com/openconfig/ondatra"
 	"github.com/openconfig/ondatra/gnmi"
 	"github.com/openconfig/ygnmi/ygnmi"
+	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/bindingbackend"
 	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/binding/pinsbind"
 	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
 	"github.com/pkg/errors"
@@ -142,6 +143,9 @@ func retrieveBootTime(t *testing.T, d *ondatra.DUTDevice) (uint64, bool, error)
 // If gnoiReachability is false, then this function will poll for gNOI server to be unreachable and returns.
 func attainGnoiStateDuringReboot(t *testing.T, d *ondatra.DUTDevice, params attainGnoiStateParams) error {
 	t.Helper()
+	if params.gnoiReachability {
+		return waitForRebootedSwitch(t, d, params)
+	}
 	t.Logf("Polling gNOI server reachability in %v intervals for max duration of %v", params.checkInterval, params.waitTime)
 	for timeout := time.Now().Add(params.waitTime); time.Now().Before(timeout); {
 		// The switch backend might not have processed the reboot request or might take
@@ -151,45 +155,58 @@ func attainGnoiStateDuringReboot(t *testing.T, d *ondatra.DUTDevice, params atta
 		timeElapsed := (time.Now().UnixNano() - params.timeBeforeReboot) / int64(time.Second)
 
 		// An error returned by GNOIAble indicates we were unable to connect to the server.
-		gnoiErr := testhelper.GNOIAble(t, d)
-
-		// Treat a non GNOIAble switch and an inability to query boot-time as a server not up condition.
-		if gnoiErr != nil {
+		if err := testhelper.GNOIAble(t, d); err != nil {
 			t.Logf("gNOI server not up after %v seconds", timeElapsed)
-			if !params.gnoiReachability {
-				return nil
-			}
-			continue
+			return nil
 		}
 
 		// An error returned by retrieveBootTime is a processing error to be treated as fatal.
 		bootTime, valid, bootErr := retrieveBootTime(t, d)
-
 		if bootErr != nil {
 			return bootErr
 		}
-
+		// Treat an inability to query boot-time as a server not up condition.
 		if !valid {
 			t.Logf("gNOI server not up after %v seconds", timeElapsed)
-			if !params.gnoiReachability {
-				return nil
-			}
-			continue
+			return nil
 		}
 
-		t.Logf("gNOI server up after %v seconds", timeElapsed)
+		if bootTime >= uint64(params.timeBeforeReboot) {
+			t.Logf("Switch rebooted after %v seconds", timeElapsed)
+			return errors.Errorf("failed to reach gNOI unreachability")
+		}
+		t.Logf("Switch has not rebooted after %v seconds", timeElapsed)
+	}
+	return errors.Errorf("failed to reboot")
+}
 
-		// An extra check to ensure that the system has rebooted.
-		if bootTime < uint64(params.timeBeforeReboot) {
-			t.Logf("Switch has not rebooted after %v seconds", timeElapsed)
-			continue
+// waitForRebootedSwitch waits for the gNOI and gNMI servers with
+// WaitForServices until the boot time is after the reboot request.
+func waitForRebootedSwitch(t *testing.T, d *ondatra.DUTDevice, params attainGnoiStateParams) error {
+	t.Helper()
+	t.Logf("Waiting for the gNOI server in %v intervals for max duration of %v", params.checkInterval, params.waitTime)
+	ctx, cancel := context.WithTimeout(context.Background(), params.waitTime)
+	defer cancel()
+	for ctx.Err() == nil {
+		// The switch might not have gone down yet, in which case the servers
+		// still answer with the old boot time.
+		time.Sleep(params.checkInterval)
+		if err := testhelper.WaitForServices(ctx, d, bindingbackend.GNOI, bindingbackend.GNMI); err != nil {
+			return errors.Wrap(err, "failed to reboot")
 		}
+		timeElapsed := (time.Now().UnixNano() - params.timeBeforeReboot) / int64(time.Second)
+		t.Logf("gNOI server up after %v seconds", timeElapsed)
 
-		t.Logf("Switch rebooted after %v seconds", timeElapsed)
-		if !params.gnoiReachability {
-			return errors.Errorf("failed to reach gNOI unreachability")
+		// An error returned by retrieveBootTime is a processing error to be treated as fatal.
+		bootTime, valid, err := retrieveBootTime(t, d)
+		if err != nil {
+			return err
+		}
+		if valid && bootTime >= uint64(params.timeBeforeReboot) {
+			t.Logf("Switch rebooted after %v seconds", timeElapsed)
+			return nil
 		}
-		return nil
+		t.Logf("Switch has not rebooted after %v seconds", timeElapsed)
 	}
 	return errors.Errorf("failed to reboot")
 }
@@ -205,7 +222,7 @@ func TestRebootSuccess(t *testing.T) {
 		t.Fatalf("Unable to get reboot wait time: %v", err)
 	}
 	params := testhelper.NewRebootParams().WithWaitTime(waitTime).WithCheckInterval(30*time.Second).WithRequest(syspb.RebootMethod_COLD).WithLatencyMeasurement(ttID, "gNOI Reboot With Type: "+syspb.RebootMethod_COLD.String())
-	if err := testhelper.Reboot(t, dut, params); err != nil {
+	if err := testhelper.RebootWithStatus(t, dut, params); err != nil {
 		t.Fatalf("Failed to reboot DUT: %v", err)
 	}
 }
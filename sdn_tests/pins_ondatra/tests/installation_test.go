@@ -1,6 +1,7 @@
 package installation_test
 
 import (
+	"flag"
 	"testing"
 	"time"
 
@@ -10,6 +11,11 @@ import (
 	"github.com/sonic-net/sonic-mgmt/sdn_tests/pins_ondatra/infrastructure/testhelper/testhelper"
 )
 
+var (
+	osImage   = flag.String("os_image", "", "Path of the switch image installed by TestOSInstall.")
+	osVersion = flag.String("os_version", "", "Version of the switch image installed by TestOSInstall.")
+)
+
 func TestMain(m *testing.M) {
 	ondatra.RunTests(m, pinsbind.New)
 }
@@ -31,3 +37,20 @@ func TestConfigInstallationSuccess(t *testing.T) {
 		t.Fatalf("Failed to reboot DUT: %v", err)
 	}
 }
+
+func TestOSInstall(t *testing.T) {
+	if *osImage == "" || *osVersion == "" {
+		t.Skip("--os_image and --os_version are required to install a switch image")
+	}
+	defer testhelper.NewTearDownOptions(t).Teardown(t)
+	dut := ondatra.DUT(t, "DUT")
+	waitTime, err := testhelper.RebootTimeForDevice(t, dut)
+	if err != nil {
+		t.Fatalf("Unable to get reboot wait time: %v", err)
+	}
+	rebootParams := testhelper.NewRebootParams().WithWaitTime(waitTime).WithCheckInterval(30 * time.Second).WithRequest(syspb.RebootMethod_COLD)
+	params := testhelper.NewOSInstallParams(*osImage, *osVersion).WithRebootParams(rebootParams)
+	if err := testhelper.OSInstall(t, dut, params); err != nil {
+		t.Fatalf("Failed to install version %v: %v", *osVersion, err)
+	}
+}
@@ -368,14 +368,14 @@ func TestSetIPv4AddressAndPrefixLength(t *testing.T) {
 	//   /interfaces/interface[name=<mgmt>]/subinterfaces/subinterface[index=<index>]/ipv4/addresses/address[ip=<address>]/config/prefix-length
 	//   /interfaces/interface[name=<mgmt>]/subinterfaces/subinterface[index=<index>]/ipv4/addresses/address[ip=<address>]/state/ip
 	//   /interfaces/interface[name=<mgmt>]/subinterfaces/subinterface[index=<index>]/ipv4/addresses/address[ip=<address>]/state/prefix-length
-	defer testhelper.NewTearDownOptions(t).WithID("64003075-93a5-41b3-b962-74e9f36dde94").Teardown(t)
 	dut := ondatra.DUT(t, "DUT")
 	mockConfigPush(t)
+	// The config is captured after the mock config push, which must stay.
+	defer testhelper.NewTearDownOptions(t).WithID("64003075-93a5-41b3-b962-74e9f36dde94").WithConfigRestore(t).Teardown(t)
 
 	// We can't change the management interface IP address; the connection via the
 	// proxy would be lost.  We can, however, write the existing value again.
 	newIPv4Info, err := fetchMgmtIPv4AddressAndPrefix(t)
-	restoreIPv4State := false
 
 	if err != nil {
 		// If IPv4 is not used in the testbed, we can set a valid address.
@@ -397,7 +397,6 @@ func TestSetIPv4AddressAndPrefixLength(t *testing.T) {
 		newAddr := fmt.Sprintf("%d.%d.%d.%d", firstPrefix[rand.Int()%len(firstPrefix)], rand.Intn(256), rand.Intn(256), rand.Intn(256))
 		newPrefix := uint8(rand.Intn(27) + 5) // 5 to 31
 		newIPv4Info = ipAddressInfo{address: newAddr, prefixLength: newPrefix}
-		restoreIPv4State = true
 	}
 
 	d := &oc.Root{}
@@ -408,9 +407,6 @@ func TestSetIPv4AddressAndPrefixLength(t *testing.T) {
 
 	ipv4 := gnmi.OC().Interface(bond0Name).Subinterface(interfaceIndex).Ipv4().Address(newIPv4Info.address)
 	gnmi.Replace(t, dut, gnmi.OC().Interface(bond0Name).Subinterface(interfaceIndex).Ipv4().Address(newIPv4Info.address).Config(), newV4)
-	if restoreIPv4State {
-		defer gnmi.Delete(t, dut, gnmi.OC().Interface(bond0Name).Subinterface(interfaceIndex).Ipv4().Address(newIPv4Info.address).Config())
-	}
 	// Give the configuration a chance to become active.
 	time.Sleep(1 * time.Second)
 
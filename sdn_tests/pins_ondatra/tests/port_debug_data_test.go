@@ -17,7 +17,7 @@ func TestMain(m *testing.M) {
 func TestGetPortDebugDataInvalidInterface(t *testing.T) {
 	defer testhelper.NewTearDownOptions(t).WithID("dba77fa7-b0d1-4412-8136-22dea24ed935").Teardown(t)
 	var intfName = "Ethernet99999"
-	err := testhelper.HealthzGetPortDebugData(t, ondatra.DUT(t, "DUT"), intfName);
+	_, err := testhelper.HealthzGetPortDebugData(t, ondatra.DUT(t, "DUT"), intfName);
 	if err == nil {
 		t.Fatalf("Expected RPC failure due to invalid interface %v", intfName)
 	}
@@ -40,7 +40,7 @@ func TestGetPortDebugDataWithTranscevierInserted(t *testing.T) {
 		}
 
 		t.Logf("Get port debug data from interface %v on xcvr present port %v", intfName, xcvrName)
-		err := testhelper.HealthzGetPortDebugData(t, dut, intfName)
+		_, err := testhelper.HealthzGetPortDebugData(t, dut, intfName)
 		if err != nil {
 			t.Fatalf("Expected RPC success, got error %v", err)
 		}
@@ -65,7 +65,7 @@ func TestGetPortDebugDataWithoutTranscevierInserted(t *testing.T) {
 		}
 
 		t.Logf("Get port debug data from interface %v on xcvr empty port %v", intfName, xcvrName)
-		err := testhelper.HealthzGetPortDebugData(t, dut, intfName)
+		_, err := testhelper.HealthzGetPortDebugData(t, dut, intfName)
 		if err != nil {
 			t.Fatalf("Expected RPC success, got error %v", err)
 		}